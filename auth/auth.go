@@ -0,0 +1,107 @@
+// Package auth authenticates requests carrying either the cookies of a cookie.Client or a
+// bearer token, so handlers and middleware only deal with cookie.Data.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Seann-Moser/cutil/logc"
+	cookie "github.com/Seann-Moser/rutil/cook"
+	"go.uber.org/zap"
+)
+
+type Carrier string
+
+const (
+	CarrierCookie Carrier = "cookie"
+	CarrierBearer Carrier = "bearer"
+)
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type identityContextKey struct{}
+
+type identity struct {
+	data    *cookie.Data
+	carrier Carrier
+}
+
+type Authenticator struct {
+	Cookies *cookie.Client
+	Bearer  *cookie.JWT
+}
+
+// New authenticates with cookies of c and tokens of bearer, either can be nil.
+// Without bearer the HS256 carrier of c is used for Authorization headers.
+func New(c *cookie.Client, bearer *cookie.JWT) *Authenticator {
+	if bearer == nil && c != nil {
+		bearer = c.JWT()
+	}
+	return &Authenticator{Cookies: c, Bearer: bearer}
+}
+
+// Authenticate returns the data of r. A request with an Authorization header is only
+// authenticated by its bearer token, an invalid token does not fall back to cookies.
+func (a *Authenticator) Authenticate(r *http.Request) (*cookie.Data, Carrier, error) {
+	if data, carrier, found := fromContext(r.Context()); found {
+		return data, carrier, nil
+	}
+	if _, found := cookie.BearerToken(r); found {
+		if a.Bearer == nil {
+			return nil, CarrierBearer, ErrUnauthenticated
+		}
+		data, err := a.Bearer.FromRequest(r)
+		if err != nil {
+			return nil, CarrierBearer, err
+		}
+		return data, CarrierBearer, nil
+	}
+	if a.Cookies != nil {
+		if data, valid := a.Cookies.HasValidCookie(r); valid && data != nil {
+			return data, CarrierCookie, nil
+		}
+	}
+	return nil, "", ErrUnauthenticated
+}
+
+// Middleware stores the data of authenticated requests for FromRequest, unauthenticated
+// requests are passed on without data.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, carrier, err := a.Authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrUnauthenticated) {
+				logc.Debug(r.Context(), "invalid credentials", zap.String("carrier", string(carrier)), zap.Error(err))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithData(r.Context(), data, carrier)))
+	})
+}
+
+func WithData(ctx context.Context, data *cookie.Data, carrier Carrier) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, &identity{data: data, carrier: carrier})
+}
+
+func fromContext(ctx context.Context) (*cookie.Data, Carrier, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(*identity)
+	if !ok || id == nil || id.data == nil {
+		return nil, "", false
+	}
+	return id.data, id.carrier, true
+}
+
+// FromRequest returns the data stored by Middleware or mid.Authorize, regardless of the carrier.
+func FromRequest(r *http.Request) (*cookie.Data, bool) {
+	data, _, found := fromContext(r.Context())
+	return data, found
+}
+
+// CarrierFromRequest returns how the data of FromRequest was sent.
+func CarrierFromRequest(r *http.Request) (Carrier, bool) {
+	_, carrier, found := fromContext(r.Context())
+	return carrier, found
+}
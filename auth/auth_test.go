@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cookie "github.com/Seann-Moser/rutil/cook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromRequest(t *testing.T) {
+	c := &cookie.Client{DefaultExpiresDuration: time.Hour, Salt: "secret"}
+	a := New(c, nil)
+	token, err := a.Bearer.Issue(&cookie.Data{UID: "bearer-user", TokenID: "t1"})
+	require.NoError(t, err)
+
+	var (
+		data    *cookie.Data
+		carrier Carrier
+		found   bool
+	)
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, found = FromRequest(r)
+		carrier, _ = CarrierFromRequest(r)
+	}))
+
+	tests := []struct {
+		name    string
+		setup   func(r *http.Request)
+		found   bool
+		uid     string
+		carrier Carrier
+	}{
+		{"anonymous", func(r *http.Request) {}, false, "", ""},
+		{"cookie", func(r *http.Request) {
+			for _, ck := range c.GetCookies(r, &cookie.Data{UID: "cookie-user", TokenID: "t2"}) {
+				r.AddCookie(ck)
+			}
+		}, true, "cookie-user", CarrierCookie},
+		{"bearer", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}, true, "bearer-user", CarrierBearer},
+		{"invalid bearer does not fall back to cookies", func(r *http.Request) {
+			for _, ck := range c.GetCookies(r, &cookie.Data{UID: "cookie-user", TokenID: "t2"}) {
+				r.AddCookie(ck)
+			}
+			r.Header.Set("Authorization", "Bearer invalid")
+		}, false, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, carrier, found = nil, "", false
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(r)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			require.Equal(t, tt.found, found)
+			assert.Equal(t, tt.carrier, carrier)
+			if tt.found {
+				assert.Equal(t, tt.uid, data.UID)
+			}
+		})
+	}
+}
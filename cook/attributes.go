@@ -0,0 +1,119 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"go.uber.org/zap"
+)
+
+const (
+	// HostPrefix binds cookies to the exact host, browsers require Secure, Path=/ and no Domain.
+	HostPrefix = "__Host-"
+	// SecurePrefix makes browsers only accept the cookie when it is Secure.
+	SecurePrefix = "__Secure-"
+)
+
+var ErrInsecureRequest = errors.New("secure cookies can not be set on a non https request")
+
+// ParseSameSite parses lax, strict, none or default.
+func ParseSameSite(mode string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	case "default":
+		return http.SameSiteDefaultMode, nil
+	}
+	return 0, fmt.Errorf("invalid same site mode %q, expected lax, strict, none or default", mode)
+}
+
+func (c *Client) cookieName(key string) string {
+	return c.Prefix + key
+}
+
+func (c *Client) hostOnly() bool {
+	return strings.HasPrefix(c.Prefix, HostPrefix)
+}
+
+// secureCookie applies the security attributes of the client to ck.
+func (c *Client) secureCookie(ck *http.Cookie) *http.Cookie {
+	ck.Secure = c.Secure || c.hostOnly() || strings.HasPrefix(c.Prefix, SecurePrefix)
+	ck.HttpOnly = c.HttpOnly
+	ck.SameSite = c.SameSite
+	if ck.SameSite == 0 {
+		ck.SameSite = http.SameSiteLaxMode
+	}
+	if c.hostOnly() {
+		ck.Domain = ""
+		ck.Path = "/"
+	}
+	return ck
+}
+
+// writeCookie adds ck to the response, the Partitioned attribute is appended by hand since
+// http.Cookie only supports it from go 1.23.
+func (c *Client) writeCookie(w http.ResponseWriter, ck *http.Cookie) {
+	v := ck.String()
+	if v == "" {
+		return
+	}
+	if c.Partitioned {
+		v += "; Partitioned"
+	}
+	w.Header().Add("Set-Cookie", v)
+}
+
+// IsHTTPS reports whether r was made over https, directly or through a proxy setting X-Forwarded-Proto.
+func IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil || strings.EqualFold(r.URL.Scheme, "https") {
+		return true
+	}
+	if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); strings.EqualFold(strings.TrimSpace(proto), "https") {
+		return true
+	}
+	forwarded, _, _ := strings.Cut(r.Header.Get("Forwarded"), ",")
+	for _, pair := range strings.Split(forwarded, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if strings.EqualFold(key, "proto") && strings.EqualFold(strings.Trim(value, `"`), "https") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTransport warns about secure cookies set on plain http requests, browsers drop them.
+// With RequireHTTPS the request is refused instead.
+func (c *Client) checkTransport(r *http.Request) error {
+	if r == nil || IsHTTPS(r) || !(c.Secure || c.hostOnly()) {
+		return nil
+	}
+	if c.RequireHTTPS {
+		return ErrInsecureRequest
+	}
+	logc.Warn(r.Context(), "secure cookie set on a non https request", zap.String("host", r.Host))
+	return nil
+}
+
+func (c *Client) validateAttributes() error {
+	secure := c.Secure || c.hostOnly() || strings.HasPrefix(c.Prefix, SecurePrefix)
+	if c.SameSite == http.SameSiteNoneMode && !secure {
+		return fmt.Errorf("SameSite=None cookies have to be secure, set --%s", cookiesSecureFlag)
+	}
+	if c.Partitioned && !secure {
+		return fmt.Errorf("partitioned cookies have to be secure, set --%s", cookiesSecureFlag)
+	}
+	if c.hostOnly() && (c.Domain != "" || c.IgnoreSubdomain) {
+		return fmt.Errorf("%s cookies can not set a domain, unset --%s and --%s", HostPrefix, cookieDomain, cookieIgnoreSubDomain)
+	}
+	if strings.ContainsAny(c.Prefix, " \t;,=\"") {
+		return fmt.Errorf("invalid cookie prefix %q", c.Prefix)
+	}
+	return nil
+}
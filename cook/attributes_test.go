@@ -0,0 +1,92 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSameSite(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    http.SameSite
+		wantErr bool
+	}{
+		{"", http.SameSiteLaxMode, false},
+		{"Lax", http.SameSiteLaxMode, false},
+		{"strict", http.SameSiteStrictMode, false},
+		{"none", http.SameSiteNoneMode, false},
+		{"default", http.SameSiteDefaultMode, false},
+		{"sometimes", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseSameSite(tt.mode)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCookieAttributes(t *testing.T) {
+	c := &Client{
+		DefaultExpiresDuration: time.Hour,
+		Salt:                   "secret",
+		Domain:                 "example.com",
+		Secure:                 true,
+		HttpOnly:               true,
+		SameSite:               http.SameSiteStrictMode,
+		Partitioned:            true,
+		Prefix:                 HostPrefix + "app_",
+		Encrypted:              true,
+	}
+	require.Error(t, c.Validate(), "__Host- cookies can not have a domain")
+	c.Domain = ""
+	require.NoError(t, c.Validate())
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, c.SetCookie(r, w, &Data{UID: "user-1", TokenID: "token"}, false))
+	header := w.Header().Values("Set-Cookie")
+	require.Len(t, header, 1)
+	assert.True(t, strings.HasPrefix(header[0], "__Host-app_session="))
+	for _, attr := range []string{"Path=/", "HttpOnly", "Secure", "SameSite=Strict", "Partitioned"} {
+		assert.Contains(t, header[0], attr)
+	}
+	assert.NotContains(t, header[0], "Domain=")
+
+	read := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	read.Header.Set("Cookie", strings.Split(header[0], ";")[0])
+	data, valid := c.HasValidCookie(read)
+	require.True(t, valid)
+	assert.Equal(t, "user-1", data.UID)
+
+	_, valid = (&Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Encrypted: true}).HasValidCookie(read)
+	assert.False(t, valid, "cookies of other namespaces are ignored")
+}
+
+func TestCheckTransport(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Secure: true, RequireHTTPS: true}
+	plain := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	assert.ErrorIs(t, c.SetCookie(plain, httptest.NewRecorder(), &Data{UID: "user-1"}, false), ErrInsecureRequest)
+
+	proxied := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	proxied.Header.Set("X-Forwarded-Proto", "https")
+	assert.NoError(t, c.SetCookie(proxied, httptest.NewRecorder(), &Data{UID: "user-1"}, false))
+
+	forwarded := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	forwarded.Header.Set("Forwarded", `for=192.0.2.60;proto="https"`)
+	assert.True(t, IsHTTPS(forwarded))
+
+	c.RequireHTTPS = false
+	assert.NoError(t, c.SetCookie(plain, httptest.NewRecorder(), &Data{UID: "user-1"}, false))
+
+	assert.Error(t, (&Client{Salt: "secret", SameSite: http.SameSiteNoneMode}).Validate())
+	assert.Error(t, (&Client{Salt: "secret", Partitioned: true}).Validate())
+	assert.Error(t, (&Client{Salt: "secret", Prefix: "a;b"}).Validate())
+}
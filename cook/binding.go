@@ -0,0 +1,156 @@
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"github.com/Seann-Moser/rutil/pkg/device"
+	"go.uber.org/zap"
+)
+
+var ErrDeviceMismatch = errors.New("cookie was issued to another device")
+
+// DeviceBinding ties cookies to the device they were issued to. The material of the request
+// is hashed with the signing key into Data.DeviceID when the cookie is issued and compared
+// again on every request.
+type DeviceBinding interface {
+	Name() string
+	// Material returns what identifies the device making r. An empty value only matches cookies
+	// issued without a device key.
+	Material(r *http.Request) string
+}
+
+var (
+	BindNone        DeviceBinding = bindNone{}
+	BindUserAgent   DeviceBinding = bindUserAgent{}
+	BindSubnet      DeviceBinding = bindSubnet{}
+	BindFingerprint DeviceBinding = bindFingerprint{}
+	BindCountry     DeviceBinding = bindCountry{}
+)
+
+// ParseDeviceBinding returns the binding named none, user-agent, subnet, fingerprint or country.
+func ParseDeviceBinding(name string) (DeviceBinding, error) {
+	for _, b := range []DeviceBinding{BindNone, BindUserAgent, BindSubnet, BindFingerprint, BindCountry} {
+		if strings.EqualFold(strings.TrimSpace(name), b.Name()) {
+			return b, nil
+		}
+	}
+	if name == "" {
+		return BindNone, nil
+	}
+	return nil, fmt.Errorf("invalid device binding %q, expected none, user-agent, subnet, fingerprint or country", name)
+}
+
+type bindNone struct{}
+
+func (bindNone) Name() string                    { return "none" }
+func (bindNone) Material(r *http.Request) string { return "" }
+
+type bindUserAgent struct{}
+
+func (bindUserAgent) Name() string                    { return "user-agent" }
+func (bindUserAgent) Material(r *http.Request) string { return r.UserAgent() }
+
+// bindSubnet binds to the /24 of IPv4 or the /64 of IPv6 addresses, so clients keep their
+// cookies while their address changes inside the network of their provider.
+type bindSubnet struct{}
+
+func (bindSubnet) Name() string { return "subnet" }
+func (bindSubnet) Material(r *http.Request) string {
+	return subnet(requestIP(r))
+}
+
+// bindFingerprint binds to the user agent and the exact address.
+type bindFingerprint struct{}
+
+func (bindFingerprint) Name() string { return "fingerprint" }
+func (bindFingerprint) Material(r *http.Request) string {
+	ip := requestIP(r)
+	if ip == nil {
+		return r.UserAgent()
+	}
+	return r.UserAgent() + "|" + ip.String()
+}
+
+// bindCountry rejects cookies used from another country, it needs a geo database in
+// device.DefaultResolver. Requests from unknown locations only match cookies issued from one.
+type bindCountry struct{}
+
+func (bindCountry) Name() string { return "country" }
+func (bindCountry) Material(r *http.Request) string {
+	if geo := device.GeoFromRequest(r); geo != nil {
+		return geo.Country
+	}
+	return ""
+}
+
+func requestIP(r *http.Request) net.IP {
+	d := device.GetDeviceFromRequest(r)
+	if d.IPv4 != "" {
+		return device.ParseIP(d.IPv4)
+	}
+	return device.ParseIP(d.IPv6)
+}
+
+func subnet(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+func (c *Client) binding() DeviceBinding {
+	if c.DeviceBinding == nil {
+		return BindNone
+	}
+	return c.DeviceBinding
+}
+
+func deviceMAC(key []byte, binding DeviceBinding, material string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("device." + binding.Name() + "." + material))
+	return mac.Sum(nil)
+}
+
+// DeviceKey returns the Data.DeviceID of r for the device binding of the client, set it on Data
+// issued through other carriers like JWT so the binding applies to them as well.
+func (c *Client) DeviceKey(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	material := c.binding().Material(c.withResolver(r))
+	if material == "" {
+		return ""
+	}
+	keyID, key := c.keyring().active()
+	return keyID + "." + base64.RawURLEncoding.EncodeToString(deviceMAC(key, c.binding(), material))
+}
+
+// checkDevice returns ErrDeviceMismatch when cd was issued to a device that does not match r.
+func (c *Client) checkDevice(r *http.Request, cd *Data) error {
+	if c.binding() == BindNone {
+		return nil
+	}
+	material := c.binding().Material(c.withResolver(r))
+	if material == "" && cd.DeviceID == "" {
+		return nil
+	}
+	keyID, encoded, _ := strings.Cut(cd.DeviceID, ".")
+	key, active := c.keyring().key(keyID)
+	mac, err := base64.RawURLEncoding.DecodeString(encoded)
+	if key == nil || (!active && !c.RotatingSalt) || err != nil || !hmac.Equal(mac, deviceMAC(key, c.binding(), material)) {
+		logc.Info(r.Context(), "device mismatch", zap.String("uid", cd.UID), zap.String("binding", c.binding().Name()))
+		return ErrDeviceMismatch
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package cookie
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deviceRequest(ip, userAgent string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	if userAgent != "" {
+		r.Header.Set("User-Agent", userAgent)
+	}
+	return r
+}
+
+func TestDeviceBinding(t *testing.T) {
+	tests := []struct {
+		binding   string
+		ip        string
+		userAgent string
+		want      error
+	}{
+		{"none", "198.51.100.7", "other", nil},
+		{"user-agent", "198.51.100.7", "firefox", nil},
+		{"user-agent", "192.0.2.10", "other", ErrDeviceMismatch},
+		{"user-agent", "192.0.2.10", "", ErrDeviceMismatch},
+		{"subnet", "192.0.2.200", "other", nil},
+		{"subnet", "192.0.3.10", "firefox", ErrDeviceMismatch},
+		{"fingerprint", "192.0.2.10", "firefox", nil},
+		{"fingerprint", "192.0.2.11", "firefox", ErrDeviceMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.binding+" "+tt.ip+" "+tt.userAgent, func(t *testing.T) {
+			binding, err := ParseDeviceBinding(tt.binding)
+			require.NoError(t, err)
+			c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", DeviceBinding: binding}
+
+			issued := deviceRequest("192.0.2.10", "firefox")
+			cookies := c.GetCookies(issued, &Data{UID: "user-1", TokenID: "token"})
+			r := deviceRequest(tt.ip, tt.userAgent)
+			for _, ck := range cookies {
+				r.AddCookie(ck)
+			}
+			_, err = c.Authenticate(r)
+			if tt.want == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.want)
+			}
+		})
+	}
+
+	_, err := ParseDeviceBinding("mac-address")
+	assert.Error(t, err)
+}
+
+func TestDeviceIDIsSigned(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", DeviceBinding: BindUserAgent}
+	victim := c.GetCookies(deviceRequest("192.0.2.10", "firefox"), &Data{UID: "user-1", TokenID: "token"})
+	attacker := c.GetCookies(deviceRequest("203.0.113.5", "curl"), &Data{UID: "user-2", TokenID: "other"})
+
+	r := deviceRequest("203.0.113.5", "curl")
+	for _, ck := range attacker {
+		if ck.Name == DeviceID {
+			r.AddCookie(ck)
+		}
+	}
+	for _, ck := range victim {
+		if ck.Name != DeviceID {
+			r.AddCookie(ck)
+		}
+	}
+	_, err := c.Authenticate(r)
+	assert.ErrorIs(t, err, ErrInvalidSignature, "swapping the device id breaks the signature")
+
+	cd := &Data{UID: "user-1", TokenID: "token", DeviceID: "device", Expires: time.Now().Add(time.Hour)}
+	keyID, key := c.keyring().active()
+	v1 := "v1." + keyID + "." + encodeMAC(signData(signatureV1, keyID, key, cd))
+	c.AllowLegacySignature = true
+	assert.False(t, c.ValidSignature(cd, v1), "v1 signatures do not cover the device id")
+	assert.False(t, c.ValidSignature(cd, c.legacySignature(cd)), "unkeyed signatures do not cover the device id")
+	v2 := "v2." + keyID + "." + encodeMAC(signData(signatureV2, keyID, key, cd))
+	assert.True(t, c.ValidSignature(cd, v2))
+
+	c.DeviceBinding = BindNone
+	assert.True(t, c.ValidSignature(cd, v1), "v1 signatures are accepted without device binding")
+	c.AllowLegacySignature = false
+	assert.False(t, c.ValidSignature(cd, v1), "v1 signatures are opt in")
+}
+
+func encodeMAC(mac []byte) string {
+	return base64.RawURLEncoding.EncodeToString(mac)
+}
+
+func TestDeviceBindingTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", DeviceBinding: BindSubnet, TrustedProxies: proxies}
+
+	forwarded := func(remoteAddr, forwardedFor string) *http.Request {
+		r := deviceRequest(remoteAddr, "firefox")
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		return r
+	}
+	cookies := c.GetCookies(forwarded("10.0.0.1", "192.0.2.10"), &Data{UID: "user-1", TokenID: "token"})
+
+	for _, tt := range []struct {
+		r    *http.Request
+		want error
+	}{
+		{forwarded("10.0.0.2", "192.0.2.99"), nil},
+		{forwarded("10.0.0.2", "198.51.100.1"), ErrDeviceMismatch},
+		{forwarded("203.0.113.5", "192.0.2.10"), ErrDeviceMismatch},
+	} {
+		for _, ck := range cookies {
+			tt.r.AddCookie(ck)
+		}
+		_, err = c.Authenticate(tt.r)
+		if tt.want == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, tt.want)
+		}
+	}
+}
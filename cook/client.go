@@ -1,11 +1,10 @@
 package cookie
 
 import (
-	"crypto/sha256"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"github.com/Seann-Moser/cutil/logc"
-	"github.com/Seann-Moser/rutil/pkg/device"
 	"github.com/google/uuid"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -20,10 +19,41 @@ import (
 type Client struct {
 	DefaultExpiresDuration time.Duration
 	Salt                   string
-	VerifySignature        bool
-	RotatingSalt           bool
-	Domain                 string
-	IgnoreSubdomain        bool
+	// VerifySignature can only turn off signature checks in DevMode, signatures are always verified otherwise.
+	VerifySignature bool
+	// RotatingSalt accepts cookies signed with the retired keys of Keys.
+	RotatingSalt bool
+	Domain       string
+	// IgnoreSubdomain scopes cookies to the registrable domain of the request host, see GetDomain.
+	IgnoreSubdomain bool
+	// AllowedDomains limits the domains cookies are scoped to when IgnoreSubdomain is set.
+	AllowedDomains []string
+	// TrustedProxies are the networks allowed to set X-Forwarded-Host and forward the client ip
+	// for device binding and sessions, device.DefaultResolver is used when empty.
+	TrustedProxies       []*net.IPNet
+	Keys                 *Keyring
+	AllowLegacySignature bool
+	DevMode              bool
+	// Encrypted stores the whole Data, including Meta, in a single AES-GCM encrypted cookie.
+	// The legacy multi cookie format is still read so existing sessions keep working.
+	Encrypted bool
+	// Sessions makes cookies revocable, cookies without a session in the store are rejected.
+	Sessions SessionStore
+	// RenewAfter is the fraction of DefaultExpiresDuration after which a cookie is renewed, 0 disables renewal.
+	RenewAfter float64
+	// MaxSessionAge limits how long a cookie can be renewed for, counted from Data.Timestamp. 0 is unlimited.
+	MaxSessionAge time.Duration
+	Secure        bool
+	HttpOnly      bool
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite    http.SameSite
+	Partitioned bool
+	// Prefix namespaces the cookie names, HostPrefix and SecurePrefix enforce their browser rules.
+	Prefix string
+	// RequireHTTPS refuses to set secure cookies on plain http requests instead of only warning.
+	RequireHTTPS bool
+	// DeviceBinding rejects cookies used from another device with ErrDeviceMismatch, it defaults to BindNone.
+	DeviceBinding DeviceBinding
 }
 
 const (
@@ -32,55 +62,175 @@ const (
 	cookieDomain               = "cookie-domain"
 	cookieIgnoreSubDomain      = "cookie-ignore-subdomain"
 	cookiesVerifySignatureFlag = "cookie-verify-signature-flag"
+	cookiesRotatingSaltFlag    = "cookie-rotating-salt"
+	cookiesSigningKeysFlag     = "cookie-signing-keys"
+	cookiesLegacySignatureFlag = "cookie-allow-legacy-signature"
+	cookiesDevModeFlag         = "cookie-dev-mode"
+	cookiesEncryptedFlag       = "cookie-encrypted"
+	cookiesRenewAfterFlag      = "cookie-renew-after"
+	cookiesMaxSessionAgeFlag   = "cookie-max-session-age"
+	cookiesSecureFlag          = "cookie-secure"
+	cookiesHttpOnlyFlag        = "cookie-http-only"
+	cookiesSameSiteFlag        = "cookie-same-site"
+	cookiesPartitionedFlag     = "cookie-partitioned"
+	cookiesPrefixFlag          = "cookie-prefix"
+	cookiesRequireHTTPSFlag    = "cookie-require-https"
+	cookiesDeviceBindingFlag   = "cookie-device-binding"
+	cookiesAllowedDomainsFlag  = "cookie-allowed-domains"
+	cookiesTrustedProxiesFlag  = "cookie-trusted-proxies"
 )
 
 func Flags() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("cookie", pflag.ExitOnError)
 	fs.Duration(cookiesDefaultExpiresFlag, 2*7*24*time.Hour, "")
-	fs.String(cookiesSaltFlag, "12345678", "")
+	fs.String(cookiesSaltFlag, DefaultSalt, "")
 	fs.String(cookieDomain, "", "")
-	fs.Bool(cookiesVerifySignatureFlag, false, "verify cookie signature")
+	fs.Bool(cookiesVerifySignatureFlag, true, "verify cookie signature, can only be disabled in dev mode")
+	fs.Bool(cookiesRotatingSaltFlag, true, "accept cookies signed with retired signing keys")
+	fs.StringSlice(cookiesSigningKeysFlag, nil, "cookie hmac signing keys as id:secret, the first key is used to sign new cookies")
+	fs.Bool(cookiesLegacySignatureFlag, false, "accept v2 cookie signatures, and v1 and unkeyed sha256 ones when cookies are not device bound")
+	fs.Bool(cookiesDevModeFlag, false, "allow the default salt and disabling signature verification")
+	fs.Bool(cookiesEncryptedFlag, false, "store the cookie data in a single encrypted cookie")
+	fs.Float64(cookiesRenewAfterFlag, 0.5, "renew cookies once this fraction of their lifetime has passed, 0 disables renewal")
+	fs.Duration(cookiesMaxSessionAgeFlag, 0, "absolute maximum age of a session regardless of renewals, 0 is unlimited")
+	fs.Bool(cookiesSecureFlag, true, "only send cookies over https")
+	fs.Bool(cookiesHttpOnlyFlag, true, "hide cookies from javascript")
+	fs.String(cookiesSameSiteFlag, "lax", "cookie same site mode: lax, strict, none or default")
+	fs.Bool(cookiesPartitionedFlag, false, "partition cookies by top level site (CHIPS)")
+	fs.String(cookiesPrefixFlag, "", "cookie name prefix, ie. __Host- or app_")
+	fs.Bool(cookiesRequireHTTPSFlag, false, "refuse to set secure cookies on plain http requests")
+	fs.String(cookiesDeviceBindingFlag, "none", "bind cookies to the device: none, user-agent, subnet, fingerprint or country")
 	fs.Bool(cookieIgnoreSubDomain, false, "ignore subdomain ie. test.example.com => .example.com")
+	fs.StringSlice(cookiesAllowedDomainsFlag, nil, "domains cookies may be scoped to with --"+cookieIgnoreSubDomain)
+	fs.StringSlice(cookiesTrustedProxiesFlag, nil, "ips or cidrs of proxies allowed to set X-Forwarded-Host")
 	return fs
 }
 
-func NewFromFlags() *Client {
-	return &Client{
+func NewFromFlags() (*Client, error) {
+	c := &Client{
 		DefaultExpiresDuration: viper.GetDuration(cookiesDefaultExpiresFlag),
 		Salt:                   viper.GetString(cookiesSaltFlag),
 		VerifySignature:        viper.GetBool(cookiesVerifySignatureFlag),
+		RotatingSalt:           viper.GetBool(cookiesRotatingSaltFlag),
 		Domain:                 viper.GetString(cookieDomain),
 		IgnoreSubdomain:        viper.GetBool(cookieIgnoreSubDomain),
+		AllowedDomains:         viper.GetStringSlice(cookiesAllowedDomainsFlag),
+		AllowLegacySignature:   viper.GetBool(cookiesLegacySignatureFlag),
+		DevMode:                viper.GetBool(cookiesDevModeFlag),
+		Encrypted:              viper.GetBool(cookiesEncryptedFlag),
+		RenewAfter:             viper.GetFloat64(cookiesRenewAfterFlag),
+		MaxSessionAge:          viper.GetDuration(cookiesMaxSessionAgeFlag),
+		Secure:                 viper.GetBool(cookiesSecureFlag),
+		HttpOnly:               viper.GetBool(cookiesHttpOnlyFlag),
+		Partitioned:            viper.GetBool(cookiesPartitionedFlag),
+		Prefix:                 viper.GetString(cookiesPrefixFlag),
+		RequireHTTPS:           viper.GetBool(cookiesRequireHTTPSFlag),
 	}
+	sameSite, err := ParseSameSite(viper.GetString(cookiesSameSiteFlag))
+	if err != nil {
+		return nil, err
+	}
+	c.SameSite = sameSite
+	if c.DeviceBinding, err = ParseDeviceBinding(viper.GetString(cookiesDeviceBindingFlag)); err != nil {
+		return nil, err
+	}
+	if c.TrustedProxies, err = ParseTrustedProxies(viper.GetStringSlice(cookiesTrustedProxiesFlag)...); err != nil {
+		return nil, err
+	}
+	if keys := viper.GetStringSlice(cookiesSigningKeysFlag); len(keys) > 0 {
+		keyring, err := ParseKeyring(keys...)
+		if err != nil {
+			return nil, err
+		}
+		c.Keys = keyring
+	}
+	return c, c.Validate()
+}
+
+// Validate refuses a client signing with the default or an empty salt outside of dev mode
+// and cookie attributes browsers would reject.
+func (c *Client) Validate() error {
+	if c.RenewAfter < 0 || c.RenewAfter >= 1 {
+		return fmt.Errorf("--%s has to be between 0 and 1, got %v", cookiesRenewAfterFlag, c.RenewAfter)
+	}
+	if err := c.validateAttributes(); err != nil {
+		return err
+	}
+	if err := c.validateDomains(); err != nil {
+		return err
+	}
+	if c.DevMode {
+		return nil
+	}
+	if c.Keys == nil && (c.Salt == "" || c.Salt == DefaultSalt) {
+		return fmt.Errorf("cookie signing key is the default salt, set --%s or --%s", cookiesSigningKeysFlag, cookiesSaltFlag)
+	}
+	return nil
 }
 
+// GenerateSignature signs cd with HMAC-SHA256 using the active key, the key id is part of the signature.
 func (c *Client) GenerateSignature(cd *Data) string {
-	signatureRaw := cd.UniqueID() + c.Salt
-	harsher := sha256.New()
-	harsher.Write([]byte(signatureRaw))
-	return base64.URLEncoding.EncodeToString(harsher.Sum(nil))
+	keyID, key := c.keyring().active()
+	return signatureVersion + "." + keyID + "." + base64.RawURLEncoding.EncodeToString(signData(signatureVersion, keyID, key, cd))
 }
 
 func (c *Client) HasValidCookie(r *http.Request) (*Data, bool) {
-	requestCookieData, err := GetCookieData(r)
+	cd, err := c.Authenticate(r)
 	if err != nil {
 		logc.Debug(r.Context(), "invalid cookie", zap.Error(err))
-		return nil, false
 	}
-	cd := c.copyCookieData(r, requestCookieData)
-	validSignature := requestCookieData.Signature == c.GenerateSignature(cd)
-	if !validSignature {
-		logc.Warn(r.Context(), "invalid signature", zap.Any("copy", cd), zap.Any("request", requestCookieData), zap.String("expected", c.GenerateSignature(c.copyCookieData(r, requestCookieData))), zap.String("recieved", requestCookieData.Signature))
+	return cd, err == nil
+}
+
+// Authenticate verifies the cookies of r. The errors tell apart why a cookie was refused, ie.
+// ErrDeviceMismatch should trigger a new login rather than be treated as a forged cookie.
+// The data of a cookie with a valid format is returned even when it is refused.
+func (c *Client) Authenticate(r *http.Request) (*Data, error) {
+	cd, found, err := c.readSession(r)
+	if found && err != nil {
+		return nil, err
 	}
+	if !found {
+		cd, err = getCookieData(r, c.cookieName)
+		if err != nil {
+			return nil, err
+		}
+		if !c.DevMode || c.VerifySignature {
+			if !c.ValidSignature(c.copyCookieData(cd), cd.Signature) {
+				logc.Warn(r.Context(), "invalid signature", zap.String("uid", cd.UID), zap.String("token_id", cd.TokenID))
+				return cd, ErrInvalidSignature
+			}
+		}
+	}
+	return cd, c.verifyData(r, cd)
+}
 
-	return requestCookieData, validSignature
+// verifyData runs the checks shared by every carrier of Data.
+func (c *Client) verifyData(r *http.Request, cd *Data) error {
+	if err := c.checkMaxAge(r, cd); err != nil {
+		return err
+	}
+	if err := c.checkDevice(r, cd); err != nil {
+		return err
+	}
+	return c.checkSession(r, cd)
+}
+
+// GetData returns the unverified cookie data of r in either format, use HasValidCookie to authenticate a request.
+func (c *Client) GetData(r *http.Request) (*Data, error) {
+	cd, found, err := c.readSession(r)
+	if found {
+		return cd, err
+	}
+	return getCookieData(r, c.cookieName)
 }
-func (c *Client) copyCookieData(r *http.Request, cd *Data) *Data {
+
+func (c *Client) copyCookieData(cd *Data) *Data {
 	return &Data{
 		TokenID:   cd.TokenID,
 		AccountID: cd.AccountID,
 		UID:       cd.UID,
-		DeviceID:  device.GetDeviceFromRequest(r).IPv4,
+		DeviceID:  cd.DeviceID,
 		Roles:     cd.Roles,
 		Expires:   cd.Expires,
 		Signature: "",
@@ -89,33 +239,50 @@ func (c *Client) copyCookieData(r *http.Request, cd *Data) *Data {
 	}
 }
 
+// GetCookies returns the cookies of cd and saves its session, nil is returned when either fails.
 func (c *Client) GetCookies(r *http.Request, cd *Data) []*http.Cookie {
-	key := uuid.New().String()
-	if r != nil {
-		key = device.GetDeviceFromRequest(r).GenerateDeviceKey(c.Salt)
-	}
-	var cookies []*http.Cookie
 	if cd == nil {
 		cd = &Data{}
 	}
-	cd.DeviceID = key
-	cd.Timestamp = time.Now().UTC()
-	cd.Expires = time.Now().UTC().Add(c.DefaultExpiresDuration)
-	domain := c.Domain
-	if domain == "" && c.IgnoreSubdomain && r != nil {
-		domain = c.GetDomain(r)
+	cd.DeviceID = c.DeviceKey(r)
+	cookies, err := c.cookies(r, cd)
+	if err == nil {
+		err = c.saveSession(r, cd, false)
+	}
+	if err != nil {
+		ctx := context.Background()
+		if r != nil {
+			ctx = r.Context()
+		}
+		logc.Error(ctx, "failed creating cookies", zap.Error(err))
+		return nil
 	}
+	return cookies
+}
 
-	cookies = append(cookies, getCookie(cd, DeviceID, cd.DeviceID, "", domain))
-	cookies = append(cookies, getCookie(cd, AccountID, cd.AccountID, "", domain))
-	cookies = append(cookies, getCookie(cd, TokenID, cd.TokenID, "", domain))
-	cookies = append(cookies, getCookie(cd, UID, cd.UID, "", domain))
-	cookies = append(cookies, getCookie(cd, Timestamp, strconv.Itoa(int(cd.Timestamp.UTC().Unix())), "", domain))
-	cookies = append(cookies, getCookie(cd, Expires, strconv.Itoa(int(cd.Expires.UTC().Unix())), "", domain))
-	cookies = append(cookies, getCookie(cd, Roles, strings.Join(cd.Roles, ","), "", domain))
+// cookies sets the timestamps of cd and returns its cookies in the configured format.
+func (c *Client) cookies(r *http.Request, cd *Data) ([]*http.Cookie, error) {
+	now := time.Now().UTC()
+	if cd.Timestamp.IsZero() {
+		cd.Timestamp = now
+	}
+	cd.Expires = c.expiresAt(cd, now)
+	domain := c.cookieDomain(r)
+	if c.Encrypted {
+		return c.encryptedCookies(cd, domain)
+	}
 
-	cookies = append(cookies, getCookie(cd, Signature, c.GenerateSignature(cd), "", domain))
-	return cookies
+	var cookies []*http.Cookie
+	cookies = append(cookies, c.getCookie(cd, DeviceID, cd.DeviceID, domain))
+	cookies = append(cookies, c.getCookie(cd, AccountID, cd.AccountID, domain))
+	cookies = append(cookies, c.getCookie(cd, TokenID, cd.TokenID, domain))
+	cookies = append(cookies, c.getCookie(cd, UID, cd.UID, domain))
+	cookies = append(cookies, c.getCookie(cd, Timestamp, strconv.Itoa(int(cd.Timestamp.UTC().Unix())), domain))
+	cookies = append(cookies, c.getCookie(cd, Expires, strconv.Itoa(int(cd.Expires.UTC().Unix())), domain))
+	cookies = append(cookies, c.getCookie(cd, Roles, strings.Join(cd.Roles, ","), domain))
+
+	cookies = append(cookies, c.getCookie(cd, Signature, c.GenerateSignature(cd), domain))
+	return cookies, nil
 }
 
 func (c *Client) SetCookie(r *http.Request, w http.ResponseWriter, cd *Data, clear bool) error {
@@ -123,58 +290,52 @@ func (c *Client) SetCookie(r *http.Request, w http.ResponseWriter, cd *Data, cle
 		cd = &Data{}
 		clear = true
 	}
-	cookies := c.GetCookies(r, cd)
+	if err := c.checkTransport(r); err != nil {
+		return err
+	}
+	cd.DeviceID = c.DeviceKey(r)
+	cookies, err := c.cookies(r, cd)
+	if err != nil {
+		return err
+	}
+	if err = c.saveSession(r, cd, clear); err != nil {
+		return err
+	}
 	for _, cookie := range cookies {
 		if clear {
 			cookie.MaxAge = -1
 			cookie.Expires = time.Now()
 		}
 		r.AddCookie(cookie)
-		http.SetCookie(w, cookie)
+		c.writeCookie(w, cookie)
+	}
+	if len(cookies) > 0 {
+		for _, cookie := range c.staleCookies(r, cookies, cookies[0].Domain) {
+			c.writeCookie(w, cookie)
+		}
 	}
 
 	return nil
 }
 
+// SetRequestCookie adds the cookies of d to r and saves its session, nothing is added when either fails.
 func (c *Client) SetRequestCookie(r *http.Request, d *Data) {
-	d.DeviceID = device.GetDeviceFromRequest(r).IPv4
-	d.Timestamp = time.Now().UTC()
-	d.Expires = time.Now().UTC().Add(c.DefaultExpiresDuration)
-	var cookies []*http.Cookie
-	domain := c.Domain
-	if domain == "" && c.IgnoreSubdomain {
-		domain = c.GetDomain(r)
-	}
-	cookies = append(cookies, getCookie(d, DeviceID, d.DeviceID, "", domain))
-	cookies = append(cookies, getCookie(d, AccountID, d.AccountID, "", domain))
-	cookies = append(cookies, getCookie(d, TokenID, d.TokenID, "", domain))
-	cookies = append(cookies, getCookie(d, UID, d.UID, "", domain))
-	cookies = append(cookies, getCookie(d, Timestamp, strconv.Itoa(int(d.Timestamp.UTC().Unix())), "", domain))
-	cookies = append(cookies, getCookie(d, Expires, strconv.Itoa(int(d.Expires.UTC().Unix())), "", domain))
-	cookies = append(cookies, getCookie(d, Roles, strings.Join(d.Roles, ","), "", domain))
-
-	cookies = append(cookies, getCookie(d, Signature, c.GenerateSignature(d), "", domain))
-	for _, cookie := range cookies {
-		r.AddCookie(cookie)
+	d.DeviceID = c.DeviceKey(r)
+	cookies, err := c.cookies(r, d)
+	if err == nil {
+		err = c.saveSession(r, d, false)
 	}
-}
-
-func (c *Client) GetDomain(r *http.Request) string {
-	host := r.URL.Host
-	host = strings.TrimSpace(host)
-	addr := net.ParseIP(host)
-	if addr != nil {
-		return ""
+	if err != nil {
+		logc.Error(r.Context(), "failed creating request cookies", zap.Error(err))
+		return
 	}
-	hostParts := strings.Split(host, ".")
-	if len(hostParts) > 2 {
-		return "." + strings.Join(hostParts[1:], ".")
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
 	}
-	return ""
 }
 
 func (c *Client) GetAccountID(w http.ResponseWriter, r *http.Request) string {
-	user, _ := GetCookieData(r)
+	user, _ := c.GetData(r)
 	if user != nil && user.AccountID != "" {
 		return user.AccountID
 	}
@@ -183,32 +344,31 @@ func (c *Client) GetAccountID(w http.ResponseWriter, r *http.Request) string {
 
 func (c *Client) SetUniqueID(w http.ResponseWriter, r *http.Request) string {
 	uid := uuid.New().String()
-	domain := c.Domain
-	if domain == "" && c.IgnoreSubdomain {
-		domain = c.GetDomain(r)
-	}
+	domain := c.cookieDomain(r)
 
-	cd := &http.Cookie{
-		Name:     "nsiuid",
-		Value:    uid,
-		Domain:   domain,
-		SameSite: http.SameSiteLaxMode,
-		Path:     "/",
-		MaxAge:   0,
+	if err := c.checkTransport(r); err != nil {
+		logc.Warn(r.Context(), "setting unique id cookie", zap.Error(err))
 	}
+	cd := c.secureCookie(&http.Cookie{
+		Name:   c.cookieName("nsiuid"),
+		Value:  uid,
+		Domain: domain,
+		Path:   "/",
+		MaxAge: 0,
+	})
 
 	r.AddCookie(cd)
-	http.SetCookie(w, cd)
+	c.writeCookie(w, cd)
 
 	return uid
 }
 
 func (c *Client) GetUniqueID(w http.ResponseWriter, r *http.Request) string {
-	user, _ := GetCookieData(r)
+	user, _ := c.GetData(r)
 	if user != nil && user.UID != "" {
 		return user.UID
 	}
-	nsiuid, err := r.Cookie("nsiuid")
+	nsiuid, err := r.Cookie(c.cookieName("nsiuid"))
 	if err != nil || nsiuid == nil || nsiuid.Value == "" {
 		return c.SetUniqueID(w, r)
 	}
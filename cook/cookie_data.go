@@ -6,6 +6,7 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,29 +33,34 @@ type Data struct {
 	Meta      map[string]string `json:"meta"`
 }
 
+// GetCookieData reads the legacy cookies without a name prefix, use Client.GetData for clients with a Prefix.
 func GetCookieData(r *http.Request) (*Data, error) {
+	return getCookieData(r, func(key string) string { return key })
+}
+
+func getCookieData(r *http.Request, name func(key string) string) (*Data, error) {
 	var err error
 	auth := &Data{}
-	auth.TokenID, err = getCookieValue(TokenID, r)
+	auth.TokenID, err = getCookieValue(name(TokenID), r)
 	if err != nil {
 		return nil, err
 	}
-	auth.AccountID, err = getCookieValue(AccountID, r)
+	auth.AccountID, err = getCookieValue(name(AccountID), r)
 	if err != nil {
 		return nil, err
 	}
-	auth.Signature, err = getCookieValue(Signature, r)
+	auth.Signature, err = getCookieValue(name(Signature), r)
 	if err != nil {
 		return nil, err
 	}
 	if auth.Signature == "" {
 		return auth, fmt.Errorf("no cookie data found")
 	}
-	auth.UID, err = getCookieValue(UID, r)
+	auth.UID, err = getCookieValue(name(UID), r)
 	if err != nil {
 		return nil, err
 	}
-	if rawExpires, _ := getCookieValue(Expires, r); rawExpires != "" {
+	if rawExpires, _ := getCookieValue(name(Expires), r); rawExpires != "" {
 		expires, err := strconv.Atoi(rawExpires)
 		if err != nil {
 			logc.Warn(r.Context(), "failed getting expired", zap.String("raw", rawExpires))
@@ -68,7 +74,7 @@ func GetCookieData(r *http.Request) (*Data, error) {
 	if auth.Expires.Before(time.Now().UTC()) {
 		return nil, fmt.Errorf("cookie expired: expired: %s now: %s", auth.Expires.String(), time.Now().UTC())
 	}
-	if timestamp, err := getCookieValue(Timestamp, r); err != nil {
+	if timestamp, err := getCookieValue(name(Timestamp), r); err != nil {
 		return nil, err
 	} else {
 		tp, err := strconv.Atoi(timestamp)
@@ -77,10 +83,14 @@ func GetCookieData(r *http.Request) (*Data, error) {
 		}
 		auth.Timestamp = time.Unix(int64(tp), 0)
 	}
-	auth.DeviceID, _ = getCookieValue(DeviceID, r)
+	auth.DeviceID, _ = getCookieValue(name(DeviceID), r)
+	if roles, _ := getCookieValue(name(Roles), r); roles != "" {
+		auth.Roles = strings.Split(roles, ",")
+	}
 	return auth, nil
 }
 
+// UniqueID is the input of v1 and v2 signatures, it is ambiguous and only kept to verify them.
 func (d *Data) UniqueID() string {
 	return fmt.Sprintf("%s-%s-%s-%s-%d", d.UID, d.TokenID, d.AccountID, d.Roles, d.Expires.Unix())
 }
@@ -0,0 +1,175 @@
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"go.uber.org/zap"
+)
+
+const (
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "csrf_token"
+	CSRFCookie    = "csrf"
+)
+
+var (
+	ErrCSRFToken  = errors.New("invalid csrf token")
+	ErrCSRFOrigin = errors.New("cross origin request")
+)
+
+// CSRF protects cookie authenticated requests with signed double submit tokens. The token is
+// stored in a cookie readable by javascript and has to be sent back in the X-CSRF-Token header
+// or the csrf_token form field of POST, PUT and PATCH bodies. Tokens are signed with the keys
+// of the client and bound to Data.TokenID, so a token of one session can not be used for another.
+type CSRF struct {
+	client *Client
+	exempt *http.ServeMux
+	// AllowedOrigin checks the Origin or Referer of unsafe requests, same origin requests are
+	// always allowed. Use mid.CorsMiddleware.AllowsOrigin to share the cors configuration.
+	AllowedOrigin func(origin string) bool
+	// ErrorHandler writes the response of rejected requests, it defaults to a plain 403.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+func NewCSRF(c *Client) *CSRF {
+	return &CSRF{
+		client: c,
+		exempt: http.NewServeMux(),
+	}
+}
+
+// Exempt skips the checks for requests matching the http.ServeMux patterns, ie. "POST /webhooks/{id}".
+func (x *CSRF) Exempt(patterns ...string) *CSRF {
+	for _, pattern := range patterns {
+		x.exempt.Handle(pattern, http.NotFoundHandler())
+	}
+	return x
+}
+
+func (x *CSRF) isExempt(r *http.Request) bool {
+	_, pattern := x.exempt.Handler(r)
+	return pattern != ""
+}
+
+func (x *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := x.Check(r); err != nil {
+			logc.Warn(r.Context(), "rejected csrf request", zap.String("path", r.URL.Path), zap.Error(err))
+			if x.ErrorHandler != nil {
+				x.ErrorHandler(w, r, err)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check validates the origin and token of unsafe requests made with a valid cookie. Requests
+// without a cookie carry no credentials for a forged request to abuse and are not checked.
+func (x *CSRF) Check(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+	if x.isExempt(r) {
+		return nil
+	}
+	data, valid := x.client.HasValidCookie(r)
+	if !valid || data == nil {
+		return nil
+	}
+	if err := x.checkOrigin(r); err != nil {
+		return err
+	}
+	cookieToken, err := getCookieValue(x.client.cookieName(CSRFCookie), r)
+	if err != nil || cookieToken == "" {
+		return ErrCSRFToken
+	}
+	requestToken := r.Header.Get(CSRFHeader)
+	if requestToken == "" {
+		requestToken = r.PostFormValue(CSRFFormField)
+	}
+	if !hmac.Equal([]byte(cookieToken), []byte(requestToken)) || !x.validToken(data, requestToken) {
+		return ErrCSRFToken
+	}
+	return nil
+}
+
+func (x *CSRF) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return ErrCSRFOrigin
+	}
+	origin = u.Scheme + "://" + u.Host
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	if x.AllowedOrigin != nil && x.AllowedOrigin(origin) {
+		return nil
+	}
+	return ErrCSRFOrigin
+}
+
+// Token returns the csrf token of the session of r for templates or a SPA bootstrap call,
+// setting the csrf cookie when it is missing or belongs to another session.
+func (x *CSRF) Token(w http.ResponseWriter, r *http.Request) (string, error) {
+	data, valid := x.client.HasValidCookie(r)
+	if !valid || data == nil {
+		return "", ErrCSRFToken
+	}
+	if current, err := getCookieValue(x.client.cookieName(CSRFCookie), r); err == nil && x.validToken(data, current) {
+		return current, nil
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	keyID, key := x.client.keyring().active()
+	encoded := base64.RawURLEncoding.EncodeToString(nonce)
+	token := keyID + "." + encoded + "." + base64.RawURLEncoding.EncodeToString(csrfMAC(key, data.TokenID, encoded))
+
+	ck := x.client.getCookie(data, CSRFCookie, token, x.client.cookieDomain(r))
+	ck.HttpOnly = false
+	r.AddCookie(ck)
+	x.client.writeCookie(w, ck)
+	return token, nil
+}
+
+func (x *CSRF) validToken(data *Data, token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || data.TokenID == "" {
+		return false
+	}
+	key, active := x.client.keyring().key(parts[0])
+	if key == nil || (!active && !x.client.RotatingSalt) {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, csrfMAC(key, data.TokenID, parts[1]))
+}
+
+func csrfMAC(key []byte, tokenID, nonce string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("csrf." + tokenID + "." + nonce))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,100 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRF(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", HttpOnly: true}
+	csrf := NewCSRF(c).Exempt("POST /webhooks/{id}")
+	csrf.AllowedOrigin = func(origin string) bool { return origin == "https://app.example.com" }
+	handler := csrf.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	session := func(tokenID string) []*http.Cookie {
+		return c.GetCookies(nil, &Data{UID: "user-1", TokenID: tokenID})
+	}
+	tokenFor := func(cookies []*http.Cookie) (string, *http.Cookie) {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		for _, ck := range cookies {
+			r.AddCookie(ck)
+		}
+		w := httptest.NewRecorder()
+		token, err := csrf.Token(w, r)
+		require.NoError(t, err)
+		ck := w.Result().Cookies()[0]
+		assert.False(t, ck.HttpOnly, "the csrf cookie has to be readable by javascript")
+		return token, ck
+	}
+	cookies := session("t1")
+	token, tokenCookie := tokenFor(cookies)
+	otherToken, otherCookie := tokenFor(session("t2"))
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		cookies []*http.Cookie
+		header  string
+		form    string
+		origin  string
+		want    int
+	}{
+		{"safe method", http.MethodGet, "/", cookies, "", "", "", http.StatusOK},
+		{"no session", http.MethodPost, "/", nil, "", "", "", http.StatusOK},
+		{"missing token", http.MethodPost, "/", append(cookies, tokenCookie), "", "", "", http.StatusForbidden},
+		{"header token", http.MethodPost, "/", append(cookies, tokenCookie), token, "", "", http.StatusOK},
+		{"form token", http.MethodPost, "/", append(cookies, tokenCookie), "", token, "", http.StatusOK},
+		{"token without cookie", http.MethodDelete, "/", cookies, token, "", "", http.StatusForbidden},
+		{"token of other session", http.MethodPost, "/", append(cookies, otherCookie), otherToken, "", "", http.StatusForbidden},
+		{"same origin", http.MethodPut, "/", append(cookies, tokenCookie), token, "", "http://example.com", http.StatusOK},
+		{"allowed origin", http.MethodPatch, "/", append(cookies, tokenCookie), token, "", "https://app.example.com", http.StatusOK},
+		{"foreign origin", http.MethodPost, "/", append(cookies, tokenCookie), token, "", "https://evil.example.org", http.StatusForbidden},
+		{"exempt", http.MethodPost, "/webhooks/stripe", cookies, "", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *strings.Reader
+			if tt.form != "" {
+				body = strings.NewReader(url.Values{CSRFFormField: {tt.form}}.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+			r := httptest.NewRequest(tt.method, "http://example.com"+tt.path, body)
+			if tt.form != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			for _, ck := range tt.cookies {
+				r.AddCookie(ck)
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range append(cookies, tokenCookie) {
+		r.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	again, err := csrf.Token(w, r)
+	require.NoError(t, err)
+	assert.Equal(t, token, again, "a valid token is reused")
+	assert.Empty(t, w.Result().Cookies())
+}
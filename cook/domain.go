@@ -0,0 +1,132 @@
+package cookie
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"github.com/Seann-Moser/rutil/pkg/device"
+	"go.uber.org/zap"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ParseTrustedProxies parses ips and cidrs, ie. 10.0.0.0/8 or 192.0.2.1, into networks.
+func ParseTrustedProxies(proxies ...string) ([]*net.IPNet, error) {
+	return device.ParseTrustedProxies(proxies...)
+}
+
+// resolver returns device.DefaultResolver with the TrustedProxies of the client.
+func (c *Client) resolver() *device.Resolver {
+	if len(c.TrustedProxies) == 0 {
+		return device.DefaultResolver
+	}
+	res := *device.DefaultResolver
+	res.TrustedProxies = c.TrustedProxies
+	return &res
+}
+
+// withResolver makes device lookups for r resolve the client ip with the TrustedProxies of the client.
+func (c *Client) withResolver(r *http.Request) *http.Request {
+	if len(c.TrustedProxies) == 0 {
+		return r
+	}
+	return r.WithContext(device.WithResolver(r.Context(), c.resolver()))
+}
+
+func (c *Client) trustedProxy(r *http.Request) bool {
+	return c.resolver().Trusted(device.ParseIP(r.RemoteAddr))
+}
+
+// RequestHost returns the lower case host r was made to without the port. X-Forwarded-Host is
+// only used when the request was made by one of the TrustedProxies, anyone else could pick the
+// domain of the cookie with it.
+func (c *Client) RequestHost(r *http.Request) string {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && c.trustedProxy(r) {
+		host, _, _ = strings.Cut(forwarded, ",")
+	}
+	return normalizeHost(host)
+}
+
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	return strings.ToLower(host)
+}
+
+// RegistrableDomain returns the domain below the public suffix of host, ie. foo.co.uk for
+// api.foo.co.uk, using the public suffix list embedded in golang.org/x/net/publicsuffix.
+// IPs, single label hosts and public suffixes have no registrable domain.
+func RegistrableDomain(host string) string {
+	host = normalizeHost(host)
+	if host == "" || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return ""
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// GetDomain returns the domain cookies set for r are scoped to, an empty domain makes them host
+// only. Without AllowedDomains this is the registrable domain of the request host, ie.
+// test.example.com => example.com. With AllowedDomains it is the most specific allowed domain
+// the host belongs to, hosts outside of them get host only cookies.
+func (c *Client) GetDomain(r *http.Request) string {
+	host := c.RequestHost(r)
+	domain := RegistrableDomain(host)
+	if domain == "" || len(c.AllowedDomains) == 0 {
+		return domain
+	}
+	var scope string
+	for _, allowed := range c.AllowedDomains {
+		allowed = normalizeHost(allowed)
+		if (host == allowed || strings.HasSuffix(host, "."+allowed)) && len(allowed) > len(scope) {
+			scope = allowed
+		}
+	}
+	if scope == "" {
+		logc.Debug(r.Context(), "host is not in the allowed cookie domains", zap.String("host", host))
+	}
+	return scope
+}
+
+func (c *Client) cookieDomain(r *http.Request) string {
+	if c.Domain == "" && c.IgnoreSubdomain && r != nil {
+		return c.GetDomain(r)
+	}
+	return c.Domain
+}
+
+func (c *Client) validateDomains() error {
+	for _, domain := range c.AllowedDomains {
+		if RegistrableDomain(domain) == "" {
+			return fmt.Errorf("cookie domain %q is not below a public suffix", domain)
+		}
+	}
+	if c.Domain == "" {
+		return nil
+	}
+	domain := normalizeHost(strings.TrimPrefix(c.Domain, "."))
+	if RegistrableDomain(domain) == "" {
+		return fmt.Errorf("--%s %q is not below a public suffix", cookieDomain, c.Domain)
+	}
+	if len(c.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, allowed := range c.AllowedDomains {
+		if normalizeHost(allowed) == domain {
+			return nil
+		}
+	}
+	return fmt.Errorf("--%s %q is not one of --%s", cookieDomain, c.Domain, cookiesAllowedDomainsFlag)
+}
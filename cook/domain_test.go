@@ -0,0 +1,79 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		"test.example.com":     "example.com",
+		"example.com":          "example.com",
+		"api.example.com:8080": "example.com",
+		"foo.co.uk":            "foo.co.uk",
+		"a.b.foo.co.uk":        "foo.co.uk",
+		"co.uk":                "",
+		"user.github.io":       "user.github.io",
+		"EXAMPLE.com.":         "example.com",
+		"localhost":            "",
+		"localhost:3000":       "",
+		"192.0.2.1":            "",
+		"[2001:db8::1]:443":    "",
+		"":                     "",
+	}
+	for host, want := range tests {
+		assert.Equal(t, want, RegistrableDomain(host), host)
+	}
+}
+
+func TestGetDomain(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8", "192.0.2.1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		host           string
+		forwardedHost  string
+		remoteAddr     string
+		allowedDomains []string
+		want           string
+	}{
+		{name: "host header", host: "api.example.com:8080", want: "example.com"},
+		{name: "public suffix", host: "foo.co.uk", want: "foo.co.uk"},
+		{name: "trusted proxy", host: "internal:8080", forwardedHost: "app.example.org", remoteAddr: "10.1.2.3:5000", want: "example.org"},
+		{name: "single trusted proxy", host: "internal", forwardedHost: "app.example.org, other", remoteAddr: "192.0.2.1:5000", want: "example.org"},
+		{name: "untrusted proxy", host: "app.example.com", forwardedHost: "evil.example.org", remoteAddr: "203.0.113.9:5000", want: "example.com"},
+		{name: "allowed", host: "a.app.example.com", allowedDomains: []string{"example.com", "app.example.com"}, want: "app.example.com"},
+		{name: "not allowed", host: "a.example.net", allowedDomains: []string{"example.com"}, want: ""},
+		{name: "ip", host: "192.0.2.10:80", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{IgnoreSubdomain: true, TrustedProxies: proxies, AllowedDomains: tt.allowedDomains}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwardedHost != "" {
+				r.Header.Set("X-Forwarded-Host", tt.forwardedHost)
+			}
+			assert.Equal(t, tt.want, c.GetDomain(r))
+			assert.Equal(t, tt.want, c.cookieDomain(r))
+		})
+	}
+}
+
+func TestValidateDomains(t *testing.T) {
+	assert.NoError(t, (&Client{Domain: ".example.com", AllowedDomains: []string{"example.com"}}).validateDomains())
+	assert.Error(t, (&Client{Domain: "co.uk"}).validateDomains())
+	assert.Error(t, (&Client{AllowedDomains: []string{"github.io"}}).validateDomains())
+	assert.Error(t, (&Client{Domain: "example.net", AllowedDomains: []string{"example.com"}}).validateDomains())
+
+	_, err := ParseTrustedProxies("not-an-ip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SessionCookie = "session"
+
+	encryptedVersion = "e1"
+	chunkedPrefix    = "chunks."
+	// MaxCookieValueSize leaves room for the name and attributes in the 4096 bytes browsers store per cookie.
+	MaxCookieValueSize = 3800
+	MaxSessionChunks   = 5
+)
+
+var (
+	ErrSessionTooLarge = errors.New("session cookie is too large")
+	ErrInvalidSession  = errors.New("invalid session cookie")
+)
+
+var legacyCookieNames = []string{DeviceID, AccountID, TokenID, UID, Timestamp, Expires, Roles, Signature}
+
+func (c *Client) aead(key []byte) (cipher.AEAD, error) {
+	// derive a separate key so the signing secret is never used directly for encryption
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("rutil cookie encryption " + encryptedVersion))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptData encrypts cd, including Meta, with AES-256-GCM using the active key of the client.
+// The value has the form "e1.<key id>.<base64 nonce and ciphertext>".
+func (c *Client) EncryptData(cd *Data) (string, error) {
+	keyID, key := c.keyring().active()
+	aead, err := c.aead(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := json.Marshal(cd)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	header := encryptedVersion + "." + keyID
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(header))
+	return header + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptData reverses EncryptData, values encrypted with retired keys are accepted while RotatingSalt is set.
+func (c *Client) DecryptData(value string) (*Data, error) {
+	parts := strings.SplitN(value, ".", 3)
+	if len(parts) != 3 || parts[0] != encryptedVersion {
+		return nil, ErrInvalidSession
+	}
+	key, active := c.keyring().key(parts[1])
+	if key == nil || (!active && !c.RotatingSalt) {
+		return nil, ErrInvalidSession
+	}
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidSession
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(parts[0]+"."+parts[1]))
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var cd Data
+	if err = json.Unmarshal(plaintext, &cd); err != nil {
+		return nil, ErrInvalidSession
+	}
+	return &cd, nil
+}
+
+// encryptedCookies returns the session cookie, split into numbered chunk cookies when the
+// value does not fit into a single cookie.
+func (c *Client) encryptedCookies(cd *Data, domain string) ([]*http.Cookie, error) {
+	value, err := c.EncryptData(cd)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) <= MaxCookieValueSize {
+		return []*http.Cookie{c.getCookie(cd, SessionCookie, value, domain)}, nil
+	}
+	chunks := (len(value) + MaxCookieValueSize - 1) / MaxCookieValueSize
+	if chunks > MaxSessionChunks {
+		return nil, fmt.Errorf("%w: %d bytes", ErrSessionTooLarge, len(value))
+	}
+	cookies := []*http.Cookie{c.getCookie(cd, SessionCookie, chunkedPrefix+strconv.Itoa(chunks), domain)}
+	for i := 0; i < chunks; i++ {
+		end := (i + 1) * MaxCookieValueSize
+		if end > len(value) {
+			end = len(value)
+		}
+		cookies = append(cookies, c.getCookie(cd, sessionChunkName(i), value[i*MaxCookieValueSize:end], domain))
+	}
+	return cookies, nil
+}
+
+func sessionChunkName(i int) string {
+	return fmt.Sprintf("%s_%d", SessionCookie, i)
+}
+
+// readSession reads the encrypted session cookie, joining chunks. found is false when the request
+// has no session cookie so the caller can fall back to the legacy format.
+func (c *Client) readSession(r *http.Request) (cd *Data, found bool, err error) {
+	value, err := getCookieValue(c.cookieName(SessionCookie), r)
+	if err != nil || value == "" {
+		return nil, false, nil
+	}
+	if strings.HasPrefix(value, chunkedPrefix) {
+		chunks, err := strconv.Atoi(strings.TrimPrefix(value, chunkedPrefix))
+		if err != nil || chunks <= 0 || chunks > MaxSessionChunks {
+			return nil, true, ErrInvalidSession
+		}
+		var joined strings.Builder
+		for i := 0; i < chunks; i++ {
+			chunk, err := getCookieValue(c.cookieName(sessionChunkName(i)), r)
+			if err != nil {
+				return nil, true, fmt.Errorf("%w: %w", ErrInvalidSession, err)
+			}
+			joined.WriteString(chunk)
+		}
+		value = joined.String()
+	}
+	cd, err = c.DecryptData(value)
+	if err != nil {
+		return nil, true, err
+	}
+	if cd.Expires.Before(time.Now().UTC()) {
+		return nil, true, fmt.Errorf("cookie expired: expired: %s now: %s", cd.Expires.String(), time.Now().UTC())
+	}
+	return cd, true, nil
+}
+
+// staleCookies returns expired cookies for the session and legacy cookies in the request that
+// are not part of cookies, so switching formats or shrinking a chunked session leaves nothing behind.
+func (c *Client) staleCookies(r *http.Request, cookies []*http.Cookie, domain string) []*http.Cookie {
+	if r == nil {
+		return nil
+	}
+	keep := map[string]bool{}
+	for _, ck := range cookies {
+		keep[ck.Name] = true
+	}
+	names := append([]string{SessionCookie}, legacyCookieNames...)
+	for i := 0; i < MaxSessionChunks; i++ {
+		names = append(names, sessionChunkName(i))
+	}
+	var stale []*http.Cookie
+	for _, name := range names {
+		name = c.cookieName(name)
+		if keep[name] {
+			continue
+		}
+		if _, err := r.Cookie(name); err == nil {
+			stale = append(stale, c.secureCookie(&http.Cookie{Name: name, Domain: domain, Path: "/", MaxAge: -1, Expires: time.Unix(0, 0)}))
+		}
+	}
+	return stale
+}
@@ -0,0 +1,95 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedCookie(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Keys: NewKeyring("k1", []byte("secret")), Encrypted: true}
+	cd := &Data{UID: "user-1", AccountID: "account", TokenID: "token", Roles: []string{"admin"}, Meta: map[string]string{"plan": "pro"}}
+
+	cookies := c.GetCookies(nil, cd)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, SessionCookie, cookies[0].Name)
+	assert.True(t, strings.HasPrefix(cookies[0].Value, "e1.k1."))
+	assert.NotContains(t, cookies[0].Value, "admin")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	data, valid := c.HasValidCookie(r)
+	require.True(t, valid)
+	assert.Equal(t, "account", data.AccountID)
+	assert.Equal(t, []string{"admin"}, data.Roles)
+	assert.Equal(t, map[string]string{"plan": "pro"}, data.Meta)
+
+	tampered := httptest.NewRequest(http.MethodGet, "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: SessionCookie, Value: cookies[0].Value[:len(cookies[0].Value)-2] + "AA"})
+	_, valid = c.HasValidCookie(tampered)
+	assert.False(t, valid)
+
+	c.Keys.Rotate("k2", []byte("other"))
+	_, valid = c.HasValidCookie(r)
+	assert.False(t, valid)
+	c.RotatingSalt = true
+	_, valid = c.HasValidCookie(r)
+	assert.True(t, valid)
+}
+
+func TestEncryptedCookieChunks(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Encrypted: true}
+	cd := &Data{UID: "user-1", Meta: map[string]string{"large": strings.Repeat("x", 2*MaxCookieValueSize)}}
+
+	cookies := c.GetCookies(nil, cd)
+	require.Len(t, cookies, 4)
+	assert.Equal(t, "chunks.3", cookies[0].Value)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range cookies {
+		assert.LessOrEqual(t, len(ck.Value), MaxCookieValueSize)
+		r.AddCookie(ck)
+	}
+	data, valid := c.HasValidCookie(r)
+	require.True(t, valid)
+	assert.Equal(t, cd.Meta, data.Meta)
+
+	missing := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range cookies[:3] {
+		missing.AddCookie(ck)
+	}
+	_, valid = c.HasValidCookie(missing)
+	assert.False(t, valid)
+
+	cd.Meta["large"] = strings.Repeat("x", MaxSessionChunks*MaxCookieValueSize)
+	_, err := c.encryptedCookies(cd, "")
+	assert.ErrorIs(t, err, ErrSessionTooLarge)
+	err = c.SetCookie(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder(), cd, false)
+	assert.ErrorIs(t, err, ErrSessionTooLarge)
+}
+
+func TestEncryptedCookieMigration(t *testing.T) {
+	legacy := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret"}
+	r := signedRequest(legacy, &Data{UID: "user-1", TokenID: "token"})
+
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Encrypted: true}
+	data, valid := c.HasValidCookie(r)
+	require.True(t, valid, "legacy cookies are read while migrating")
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.SetCookie(r, w, data, false))
+	set := map[string]*http.Cookie{}
+	for _, ck := range w.Result().Cookies() {
+		set[ck.Name] = ck
+	}
+	require.Contains(t, set, SessionCookie)
+	assert.Greater(t, set[SessionCookie].MaxAge, 0)
+	for _, name := range legacyCookieNames {
+		require.Contains(t, set, name)
+		assert.Less(t, set[name].MaxAge, 0, name)
+	}
+}
@@ -21,25 +21,14 @@ func getCookieValue(key string, r *http.Request) (string, error) {
 	return cookie.Value, nil
 }
 
-func getCookie(auth *Data, key, value, path, domain string) *http.Cookie {
-	if len(path) == 0 {
-		return &http.Cookie{
-			Name:     key,
-			Value:    value,
-			Expires:  auth.Expires,
-			Domain:   domain,
-			SameSite: http.SameSiteLaxMode,
-			Path:     "/",
-			MaxAge:   int(time.Until(auth.Expires).Seconds()),
-		}
-	}
-	return &http.Cookie{
-		Name:     key,
-		Value:    value,
-		Expires:  auth.Expires,
-		Domain:   domain,
-		Path:     path,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   int(time.Until(auth.Expires).Seconds()),
-	}
+// getCookie creates the cookie key of auth with the security attributes and name prefix of the client.
+func (c *Client) getCookie(auth *Data, key, value, domain string) *http.Cookie {
+	return c.secureCookie(&http.Cookie{
+		Name:    c.cookieName(key),
+		Value:   value,
+		Expires: auth.Expires,
+		Domain:  domain,
+		Path:    "/",
+		MaxAge:  int(time.Until(auth.Expires).Seconds()),
+	})
 }
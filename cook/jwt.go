@@ -0,0 +1,304 @@
+package cookie
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrNoBearerToken = errors.New("no bearer token")
+	ErrInvalidToken  = errors.New("invalid bearer token")
+	ErrTokenExpired  = errors.New("bearer token expired")
+)
+
+// JWT issues and verifies Data as compact JSON web tokens for the Authorization: Bearer header.
+// TokenID is the jti, UID the sub and Data.Timestamp the auth_time claim. A JWT only accepts
+// tokens signed with its own algorithm.
+type JWT struct {
+	Issuer   string
+	Audience string
+	// Expires is the lifetime of issued tokens.
+	Expires time.Duration
+	// Leeway is the clock skew allowed when checking exp and nbf.
+	Leeway time.Duration
+	// AcceptRetired accepts HS256 tokens signed with retired keys of the keyring.
+	AcceptRetired bool
+
+	alg        string
+	keys       *Keyring
+	mu         sync.RWMutex
+	signKeyID  string
+	signKey    ed25519.PrivateKey
+	publicKeys map[string]ed25519.PublicKey
+	client     *Client
+}
+
+type jwtHeader struct {
+	Alg   string `json:"alg"`
+	Typ   string `json:"typ,omitempty"`
+	KeyID string `json:"kid,omitempty"`
+}
+
+type jwtClaims struct {
+	Issuer    string            `json:"iss,omitempty"`
+	Subject   string            `json:"sub,omitempty"`
+	Audience  audience          `json:"aud,omitempty"`
+	ExpiresAt int64             `json:"exp"`
+	NotBefore int64             `json:"nbf,omitempty"`
+	IssuedAt  int64             `json:"iat,omitempty"`
+	AuthTime  int64             `json:"auth_time,omitempty"`
+	ID        string            `json:"jti,omitempty"`
+	AccountID string            `json:"account_id,omitempty"`
+	DeviceID  string            `json:"device_id,omitempty"`
+	Roles     []string          `json:"roles,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+}
+
+// audience decodes the aud claim as either a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func NewHS256(keys *Keyring) *JWT {
+	return &JWT{alg: AlgHS256, keys: keys, Expires: time.Hour, AcceptRetired: true}
+}
+
+// NewEdDSA signs tokens with key, use AddPublicKey to verify tokens of other issuers or previous keys.
+func NewEdDSA(keyID string, key ed25519.PrivateKey) *JWT {
+	j := &JWT{alg: AlgEdDSA, Expires: time.Hour, publicKeys: map[string]ed25519.PublicKey{}}
+	if key != nil {
+		j.signKeyID = keyID
+		j.signKey = key
+		j.publicKeys[keyID] = key.Public().(ed25519.PublicKey)
+	}
+	return j
+}
+
+// AddPublicKey adds an EdDSA key that is only used to verify tokens.
+func (j *JWT) AddPublicKey(keyID string, key ed25519.PublicKey) *JWT {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.publicKeys[keyID] = key
+	return j
+}
+
+// JWT returns an HS256 carrier signing with the keys of the client. Verified tokens are held to
+// the same maximum session age and session store as cookies.
+func (c *Client) JWT() *JWT {
+	j := NewHS256(c.keyring())
+	j.Expires = c.DefaultExpiresDuration
+	j.AcceptRetired = c.RotatingSalt
+	j.client = c
+	return j
+}
+
+// Issue signs cd, setting Expires to the lifetime of the token and Timestamp when it is not set.
+func (j *JWT) Issue(cd *Data) (string, error) {
+	now := time.Now().UTC()
+	if cd.Timestamp.IsZero() {
+		cd.Timestamp = now
+	}
+	cd.Expires = now.Add(j.Expires)
+	if j.client != nil && j.client.MaxSessionAge > 0 {
+		if limit := cd.Timestamp.Add(j.client.MaxSessionAge); limit.Before(cd.Expires) {
+			cd.Expires = limit
+		}
+	}
+	claims := jwtClaims{
+		Issuer:    j.Issuer,
+		Subject:   cd.UID,
+		ExpiresAt: cd.Expires.Unix(),
+		IssuedAt:  now.Unix(),
+		AuthTime:  cd.Timestamp.Unix(),
+		ID:        cd.TokenID,
+		AccountID: cd.AccountID,
+		DeviceID:  cd.DeviceID,
+		Roles:     cd.Roles,
+		Meta:      cd.Meta,
+	}
+	if j.Audience != "" {
+		claims.Audience = audience{j.Audience}
+	}
+
+	header := jwtHeader{Alg: j.alg, Typ: "JWT"}
+	switch j.alg {
+	case AlgHS256:
+		header.KeyID, _ = j.keys.active()
+	case AlgEdDSA:
+		if j.signKey == nil {
+			return "", fmt.Errorf("no EdDSA signing key, the JWT can only verify tokens")
+		}
+		header.KeyID = j.signKeyID
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	signature, err := j.sign(header.KeyID, signingInput)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (j *JWT) sign(keyID, signingInput string) ([]byte, error) {
+	if j.alg == AlgEdDSA {
+		return ed25519.Sign(j.signKey, []byte(signingInput)), nil
+	}
+	key, _ := j.keys.key(keyID)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %s", keyID)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil), nil
+}
+
+func (j *JWT) verifySignature(header *jwtHeader, signingInput string, signature []byte) bool {
+	switch j.alg {
+	case AlgHS256:
+		key, active := j.keys.key(header.KeyID)
+		if key == nil || (!active && !j.AcceptRetired) {
+			return false
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case AlgEdDSA:
+		j.mu.RLock()
+		key, found := j.publicKeys[header.KeyID]
+		j.mu.RUnlock()
+		return found && ed25519.Verify(key, []byte(signingInput), signature)
+	}
+	return false
+}
+
+// Verify checks the signature, algorithm, issuer, audience and lifetime of token and returns its Data.
+func (j *JWT) Verify(token string) (*Data, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != j.alg {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !j.verifySignature(&header, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(j.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(j.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrInvalidToken
+	}
+	if j.Issuer != "" && claims.Issuer != j.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if j.Audience != "" && !claims.Audience.contains(j.Audience) {
+		return nil, fmt.Errorf("%w: audience", ErrInvalidToken)
+	}
+
+	cd := &Data{
+		TokenID:   claims.ID,
+		AccountID: claims.AccountID,
+		UID:       claims.Subject,
+		DeviceID:  claims.DeviceID,
+		Roles:     claims.Roles,
+		Expires:   time.Unix(claims.ExpiresAt, 0).UTC(),
+		Meta:      claims.Meta,
+	}
+	if claims.AuthTime != 0 {
+		cd.Timestamp = time.Unix(claims.AuthTime, 0).UTC()
+	}
+	return cd, nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// BearerToken returns the token of the Authorization: Bearer header of r.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// FromRequest verifies the bearer token of r.
+func (j *JWT) FromRequest(r *http.Request) (*Data, error) {
+	token, found := BearerToken(r)
+	if !found {
+		return nil, ErrNoBearerToken
+	}
+	cd, err := j.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if j.client != nil {
+		if err = j.client.verifyData(r, cd); err != nil {
+			return nil, err
+		}
+	}
+	return cd, nil
+}
@@ -0,0 +1,100 @@
+package cookie
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTHS256(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Keys: NewKeyring("k1", []byte("secret"))}
+	j := c.JWT()
+	j.Issuer = "rutil"
+	j.Audience = "api"
+
+	cd := &Data{UID: "user-1", AccountID: "account", TokenID: "token", Roles: []string{"admin"}, Meta: map[string]string{"plan": "pro"}}
+	token, err := j.Issue(cd)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(token, "."))
+
+	data, err := j.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", data.UID)
+	assert.Equal(t, "account", data.AccountID)
+	assert.Equal(t, "token", data.TokenID)
+	assert.Equal(t, []string{"admin"}, data.Roles)
+	assert.Equal(t, cd.Meta, data.Meta)
+	assert.Equal(t, cd.Timestamp.Unix(), data.Timestamp.Unix())
+
+	other := NewHS256(NewKeyring("k1", []byte("other")))
+	_, err = other.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	wrongAudience := c.JWT()
+	wrongAudience.Issuer = "rutil"
+	wrongAudience.Audience = "admin"
+	_, err = wrongAudience.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	parts := strings.Split(token, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + "."
+	_, err = j.Verify(none)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired := c.JWT()
+	expired.Expires = -time.Minute
+	token, err = expired.Issue(&Data{UID: "user-1"})
+	require.NoError(t, err)
+	_, err = c.JWT().Verify(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	expired.Leeway = 2 * time.Minute
+	_, err = expired.Verify(token)
+	assert.NoError(t, err)
+}
+
+func TestJWTEdDSA(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	issuer := NewEdDSA("ed1", private)
+	token, err := issuer.Issue(&Data{UID: "service-a", TokenID: "token"})
+	require.NoError(t, err)
+
+	verifier := NewEdDSA("", nil).AddPublicKey("ed1", public)
+	data, err := verifier.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "service-a", data.UID)
+	_, err = verifier.Issue(&Data{})
+	assert.Error(t, err, "verify only carriers can not issue tokens")
+
+	hs := NewHS256(NewKeyring("ed1", public))
+	_, err = hs.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens of another algorithm are rejected")
+}
+
+func TestJWTFromRequest(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Sessions: NewMemorySessionStore()}
+	j := c.JWT()
+	token, err := j.Issue(&Data{UID: "user-1", TokenID: "token"})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err = j.FromRequest(r)
+	assert.ErrorIs(t, err, ErrNoBearerToken)
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	_, err = j.FromRequest(r)
+	assert.ErrorIs(t, err, ErrSessionNotFound, "tokens without a session are rejected")
+
+	require.NoError(t, c.Sessions.Save(r.Context(), &Session{TokenID: "token", UID: "user-1", ExpiresTimestamp: time.Now().Add(time.Hour)}))
+	data, err := j.FromRequest(r)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", data.UID)
+}
@@ -0,0 +1,64 @@
+package cookie
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSessionMaxAge   = errors.New("session exceeded the maximum session age")
+	ErrFutureTimestamp = errors.New("session timestamp is in the future")
+)
+
+// maxClockSkew is how far ahead of the local clock a session timestamp may be.
+const maxClockSkew = time.Minute
+
+// expiresAt returns when a cookie issued now expires, never later than the maximum session age.
+func (c *Client) expiresAt(cd *Data, now time.Time) time.Time {
+	expires := now.Add(c.DefaultExpiresDuration)
+	if c.MaxSessionAge > 0 {
+		if limit := cd.Timestamp.Add(c.MaxSessionAge); limit.Before(expires) {
+			return limit
+		}
+	}
+	return expires
+}
+
+// checkMaxAge refuses sessions started in the future or longer than MaxSessionAge ago.
+func (c *Client) checkMaxAge(r *http.Request, cd *Data) error {
+	if cd.Timestamp.After(time.Now().Add(maxClockSkew)) {
+		logc.Debug(r.Context(), "session timestamp in the future", zap.String("uid", cd.UID), zap.Time("timestamp", cd.Timestamp))
+		return ErrFutureTimestamp
+	}
+	if c.MaxSessionAge <= 0 {
+		return nil
+	}
+	if cd.Timestamp.IsZero() || time.Since(cd.Timestamp) > c.MaxSessionAge {
+		logc.Debug(r.Context(), "session exceeded max age", zap.String("uid", cd.UID), zap.Time("timestamp", cd.Timestamp))
+		return ErrSessionMaxAge
+	}
+	return nil
+}
+
+// NeedsRenewal reports whether RenewAfter of the lifetime of cd has passed and renewing
+// would extend it, sessions at their maximum age are not renewed.
+func (c *Client) NeedsRenewal(cd *Data, now time.Time) bool {
+	if c.RenewAfter <= 0 || cd == nil || cd.Expires.IsZero() {
+		return false
+	}
+	issued := cd.Expires.Add(-c.DefaultExpiresDuration)
+	renewAt := issued.Add(time.Duration(float64(c.DefaultExpiresDuration) * c.RenewAfter))
+	if now.Before(renewAt) {
+		return false
+	}
+	return c.expiresAt(cd, now).After(cd.Expires)
+}
+
+// Renew sets the cookie of cd again with a new Expires, the session start in Data.Timestamp is kept.
+func (c *Client) Renew(w http.ResponseWriter, r *http.Request, cd *Data) error {
+	return c.SetCookie(r, w, cd, false)
+}
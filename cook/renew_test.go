@@ -0,0 +1,95 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeedsRenewal(t *testing.T) {
+	now := time.Now().UTC()
+	c := &Client{DefaultExpiresDuration: 10 * time.Hour, RenewAfter: 0.5, MaxSessionAge: 24 * time.Hour}
+	tests := []struct {
+		name       string
+		renewAfter float64
+		issued     time.Time
+		started    time.Time
+		want       bool
+	}{
+		{"fresh", 0.5, now.Add(-time.Hour), now.Add(-time.Hour), false},
+		{"past threshold", 0.5, now.Add(-6 * time.Hour), now.Add(-6 * time.Hour), true},
+		{"disabled", 0, now.Add(-6 * time.Hour), now.Add(-6 * time.Hour), false},
+		{"at max age", 0.5, now.Add(-6 * time.Hour), now.Add(-20 * time.Hour), false},
+		{"near max age", 0.5, now.Add(-6 * time.Hour), now.Add(-16 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.RenewAfter = tt.renewAfter
+			cd := &Data{Timestamp: tt.started, Expires: c.expiresAt(&Data{Timestamp: tt.started}, tt.issued)}
+			assert.Equal(t, tt.want, c.NeedsRenewal(cd, now))
+		})
+	}
+}
+
+func TestRenew(t *testing.T) {
+	started := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", RenewAfter: 0.5, MaxSessionAge: 90 * time.Minute}
+	r := signedRequest(c, &Data{UID: "user-1", TokenID: "token", Timestamp: started})
+	data, valid := c.HasValidCookie(r)
+	require.True(t, valid)
+	assert.Equal(t, started, data.Timestamp.UTC())
+	assert.WithinDuration(t, started.Add(90*time.Minute), data.Expires, time.Second, "expires is capped by the max session age")
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.Renew(w, httptest.NewRequest(http.MethodGet, "/", nil), data))
+	renewed := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range w.Result().Cookies() {
+		renewed.AddCookie(ck)
+	}
+	data, valid = c.HasValidCookie(renewed)
+	require.True(t, valid)
+	assert.Equal(t, started, data.Timestamp.UTC(), "renewing keeps the session start")
+
+	old := signedRequest(c, &Data{UID: "user-1", TokenID: "token", Timestamp: started.Add(-time.Hour)})
+	_, valid = c.HasValidCookie(old)
+	assert.False(t, valid, "sessions older than the max age are rejected")
+}
+
+func TestMaxAgeTamperedTimestamp(t *testing.T) {
+	started := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	issuer := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret"}
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", MaxSessionAge: 90 * time.Minute}
+
+	r := signedRequest(issuer, &Data{UID: "user-1", TokenID: "token", Timestamp: started})
+	_, err := c.Authenticate(r)
+	assert.ErrorIs(t, err, ErrSessionMaxAge)
+
+	for caseName, ts := range map[string]time.Time{
+		"refreshed": time.Now(),
+		"future":    time.Now().Add(24 * time.Hour),
+	} {
+		t.Run(caseName, func(t *testing.T) {
+			tampered := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, ck := range r.Cookies() {
+				if ck.Name == Timestamp {
+					ck.Value = strconv.FormatInt(ts.Unix(), 10)
+				}
+				tampered.AddCookie(ck)
+			}
+			_, err := c.Authenticate(tampered)
+			assert.ErrorIs(t, err, ErrInvalidSignature)
+		})
+	}
+
+	future := signedRequest(issuer, &Data{UID: "user-1", TokenID: "token", Timestamp: time.Now().Add(time.Hour)})
+	_, err = c.Authenticate(future)
+	assert.ErrorIs(t, err, ErrFutureTimestamp)
+	c.MaxSessionAge = 0
+	_, err = c.Authenticate(future)
+	assert.ErrorIs(t, err, ErrFutureTimestamp, "future timestamps are refused without a max age")
+}
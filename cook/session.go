@@ -0,0 +1,345 @@
+package cookie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"github.com/Seann-Moser/rutil/pkg/device"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrNoSessionStore  = errors.New("cookie client has no session store")
+)
+
+// Session is the server side record of a cookie, a cookie is only valid while its session exists.
+type Session struct {
+	TokenID           string    `json:"token_id" db:"token_id" qc:"primary;varchar(512)"`
+	AccountID         string    `json:"account_id" db:"account_id" qc:"varchar(512)"`
+	UID               string    `json:"uid" db:"uid" qc:"varchar(512)"`
+	DeviceID          string    `json:"device_id" db:"device_id" qc:"update"`
+	UserAgent         string    `json:"user_agent" db:"user_agent" qc:"data_type::text;update"`
+	IPv4              string    `json:"ip_v4" db:"ip_v4" qc:"update"`
+	IPv6              string    `json:"ip_v6" db:"ip_v6" qc:"update"`
+	ExpiresTimestamp  time.Time `json:"expires_timestamp" db:"expires_timestamp" qc:"update"`
+	LastSeenTimestamp time.Time `json:"last_seen_timestamp" db:"last_seen_timestamp" qc:"update"`
+	CreatedTimestamp  time.Time `json:"created_timestamp" db:"created_timestamp"`
+}
+
+// NewSession creates the session of cd for the device making r.
+func NewSession(r *http.Request, cd *Data) *Session {
+	now := time.Now().UTC()
+	s := &Session{
+		TokenID:           cd.TokenID,
+		AccountID:         cd.AccountID,
+		UID:               cd.UID,
+		DeviceID:          cd.DeviceID,
+		ExpiresTimestamp:  cd.Expires,
+		LastSeenTimestamp: now,
+		CreatedTimestamp:  now,
+	}
+	if r != nil {
+		d := device.GetDeviceFromRequest(r)
+		s.UserAgent = d.UserAgent
+		s.IPv4 = d.IPv4
+		s.IPv6 = d.IPv6
+	}
+	return s
+}
+
+func (s *Session) Device() *device.Device {
+	return &device.Device{
+		ID:        s.DeviceID,
+		AccountID: s.AccountID,
+		UID:       s.UID,
+		IPv4:      s.IPv4,
+		IPv6:      s.IPv6,
+		UserAgent: s.UserAgent,
+		Profile:   device.DefaultParser.Parse(s.UserAgent, nil),
+		Active:    !s.Expired(time.Now()),
+	}
+}
+
+func (s *Session) Expired(now time.Time) bool {
+	return !s.ExpiresTimestamp.After(now)
+}
+
+// SessionStore keeps the sessions of a Client keyed by TokenID.
+type SessionStore interface {
+	// Save creates or updates the session.
+	Save(ctx context.Context, s *Session) error
+	// Get returns ErrSessionNotFound for unknown or revoked sessions.
+	Get(ctx context.Context, tokenID string) (*Session, error)
+	// List returns the sessions of the account that have not expired, oldest first.
+	List(ctx context.Context, accountID string) ([]*Session, error)
+	Revoke(ctx context.Context, tokenID string) error
+	// RevokeAll revokes every session of the account and returns how many were removed.
+	RevokeAll(ctx context.Context, accountID string) (int, error)
+	// DeleteExpired removes the sessions that expired before now.
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+var _ SessionStore = &MemorySessionStore{}
+
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]*Session{}}
+}
+
+func (m *MemorySessionStore) Save(ctx context.Context, s *Session) error {
+	if s == nil || s.TokenID == "" {
+		return fmt.Errorf("invalid session, missing token id")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session := *s
+	if current, found := m.sessions[s.TokenID]; found {
+		session.CreatedTimestamp = current.CreatedTimestamp
+	}
+	m.sessions[s.TokenID] = &session
+	return nil
+}
+
+func (m *MemorySessionStore) Get(ctx context.Context, tokenID string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, found := m.sessions[tokenID]
+	if !found {
+		return nil, ErrSessionNotFound
+	}
+	session := *s
+	return &session, nil
+}
+
+func (m *MemorySessionStore) List(ctx context.Context, accountID string) ([]*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	sessions := []*Session{}
+	for _, s := range m.sessions {
+		if s.AccountID != accountID || s.Expired(now) {
+			continue
+		}
+		session := *s
+		sessions = append(sessions, &session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedTimestamp.Before(sessions[j].CreatedTimestamp)
+	})
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) Revoke(ctx context.Context, tokenID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, tokenID)
+	return nil
+}
+
+func (m *MemorySessionStore) RevokeAll(ctx context.Context, accountID string) (int, error) {
+	return m.deleteWhere(func(s *Session) bool { return s.AccountID == accountID }), nil
+}
+
+func (m *MemorySessionStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	return m.deleteWhere(func(s *Session) bool { return s.Expired(now) }), nil
+}
+
+func (m *MemorySessionStore) deleteWhere(f func(s *Session) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for tokenID, s := range m.sessions {
+		if f(s) {
+			delete(m.sessions, tokenID)
+			removed++
+		}
+	}
+	return removed
+}
+
+var _ SessionStore = &FileSessionStore{}
+
+// FileSessionStore is a MemorySessionStore that writes every change to a json file,
+// useful for single instance deployments without a database.
+type FileSessionStore struct {
+	*MemorySessionStore
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	f := &FileSessionStore{MemorySessionStore: NewMemorySessionStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading sessions: %w", err)
+	}
+	if len(data) == 0 {
+		return f, nil
+	}
+	if err = json.Unmarshal(data, &f.sessions); err != nil {
+		return nil, fmt.Errorf("failed parsing sessions %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *FileSessionStore) Save(ctx context.Context, s *Session) error {
+	if err := f.MemorySessionStore.Save(ctx, s); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileSessionStore) Revoke(ctx context.Context, tokenID string) error {
+	if err := f.MemorySessionStore.Revoke(ctx, tokenID); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileSessionStore) RevokeAll(ctx context.Context, accountID string) (int, error) {
+	removed, err := f.MemorySessionStore.RevokeAll(ctx, accountID)
+	if err != nil || removed == 0 {
+		return removed, err
+	}
+	return removed, f.flush()
+}
+
+func (f *FileSessionStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	removed, err := f.MemorySessionStore.DeleteExpired(ctx, now)
+	if err != nil || removed == 0 {
+		return removed, err
+	}
+	return removed, f.flush()
+}
+
+// flush replaces the file atomically so a crash never leaves a partially written file behind.
+func (f *FileSessionStore) flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.MemorySessionStore.mu.RLock()
+	data, err := json.Marshal(f.sessions)
+	f.MemorySessionStore.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed writing sessions: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed writing sessions: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed writing sessions: %w", err)
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// checkSession returns ErrSessionNotFound unless cd belongs to a live session in the store of the client.
+func (c *Client) checkSession(r *http.Request, cd *Data) error {
+	if c.Sessions == nil {
+		return nil
+	}
+	if cd.TokenID == "" {
+		return ErrSessionNotFound
+	}
+	s, err := c.Sessions.Get(r.Context(), cd.TokenID)
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			logc.Error(r.Context(), "failed getting session", zap.Error(err))
+		}
+		return err
+	}
+	if s.AccountID != cd.AccountID || s.UID != cd.UID || s.Expired(time.Now()) {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (c *Client) ListSessions(ctx context.Context, accountID string) ([]*Session, error) {
+	if c.Sessions == nil {
+		return nil, ErrNoSessionStore
+	}
+	return c.Sessions.List(ctx, accountID)
+}
+
+func (c *Client) RevokeSession(ctx context.Context, tokenID string) error {
+	if c.Sessions == nil {
+		return ErrNoSessionStore
+	}
+	return c.Sessions.Revoke(ctx, tokenID)
+}
+
+// RevokeAllSessions logs the account out everywhere.
+func (c *Client) RevokeAllSessions(ctx context.Context, accountID string) (int, error) {
+	if c.Sessions == nil {
+		return 0, ErrNoSessionStore
+	}
+	return c.Sessions.RevokeAll(ctx, accountID)
+}
+
+// RunSessionGC deletes expired sessions every interval until ctx is done.
+func (c *Client) RunSessionGC(ctx context.Context, interval time.Duration) error {
+	if c.Sessions == nil {
+		return ErrNoSessionStore
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			removed, err := c.Sessions.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				logc.Error(ctx, "failed deleting expired sessions", zap.Error(err))
+				continue
+			}
+			logc.Debug(ctx, "deleted expired sessions", zap.Int("count", removed))
+		}
+	}
+}
+
+// saveSession stores the session of cd, or revokes it when clear is set. Clearing without a
+// TokenID, ie. SetCookie(r, w, nil, true) on logout, revokes the session of the cookies of r.
+func (c *Client) saveSession(r *http.Request, cd *Data, clear bool) error {
+	if c.Sessions == nil {
+		return nil
+	}
+	if clear && cd.TokenID == "" && r != nil {
+		if current, err := c.GetData(r); err == nil && current != nil {
+			cd = current
+		}
+	}
+	if cd.TokenID == "" {
+		return nil
+	}
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+		r = c.withResolver(r)
+	}
+	if clear {
+		return c.Sessions.Revoke(ctx, cd.TokenID)
+	}
+	return c.Sessions.Save(ctx, NewSession(r, cd))
+}
@@ -0,0 +1,118 @@
+package cookie
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Seann-Moser/cutil/sqlc"
+	"github.com/Seann-Moser/cutil/sqlc/orm"
+)
+
+const sessionDatabase = "sessions"
+
+var _ SessionStore = &SQLSessionStore{}
+
+// SQLSessionStore keeps sessions in the session table, call InitTables before using it.
+type SQLSessionStore struct{}
+
+func NewSQLSessionStore() *SQLSessionStore {
+	return &SQLSessionStore{}
+}
+
+func (s *SQLSessionStore) InitTables(ctx context.Context, dao *sqlc.DAO) (context.Context, error) {
+	return sqlc.AddTable[Session](ctx, dao, sessionDatabase, orm.QueryTypeSQL)
+}
+
+func (s *SQLSessionStore) table(ctx context.Context) (*orm.Table[Session], error) {
+	return sqlc.GetTableCtx[Session](ctx)
+}
+
+func (s *SQLSessionStore) Save(ctx context.Context, session *Session) error {
+	if session == nil || session.TokenID == "" {
+		return fmt.Errorf("invalid session, missing token id")
+	}
+	table, err := s.table(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = table.Upsert(ctx, nil, *session)
+	return err
+}
+
+func (s *SQLSessionStore) Get(ctx context.Context, tokenID string) (*Session, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := orm.QueryTable[Session](table).
+		Where(table.GetColumn("token_id"), "=", "AND", 0, tokenID).
+		Run(ctx, nil)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && len(rows) == 0) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+func (s *SQLSessionStore) List(ctx context.Context, accountID string) ([]*Session, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := orm.QueryTable[Session](table).
+		Where(table.GetColumn("account_id"), "=", "AND", 0, accountID).
+		Where(table.GetColumn("expires_timestamp"), ">", "AND", 0, time.Now().UTC()).
+		OrderBy(table.GetColumn("created_timestamp")).
+		Run(ctx, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []*Session{}, nil
+	}
+	return rows, err
+}
+
+func (s *SQLSessionStore) Revoke(ctx context.Context, tokenID string) error {
+	table, err := s.table(ctx)
+	if err != nil {
+		return err
+	}
+	return table.Delete(ctx, nil, Session{TokenID: tokenID})
+}
+
+func (s *SQLSessionStore) RevokeAll(ctx context.Context, accountID string) (int, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.deleteWhere(ctx, table, orm.QueryTable[Session](table).
+		Where(table.GetColumn("account_id"), "=", "AND", 0, accountID))
+}
+
+func (s *SQLSessionStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.deleteWhere(ctx, table, orm.QueryTable[Session](table).
+		Where(table.GetColumn("expires_timestamp"), "<=", "AND", 0, now.UTC()))
+}
+
+func (s *SQLSessionStore) deleteWhere(ctx context.Context, table *orm.Table[Session], q *orm.Query[Session]) (int, error) {
+	rows, err := q.Run(ctx, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i, row := range rows {
+		if err = table.Delete(ctx, nil, *row); err != nil {
+			return i, fmt.Errorf("failed revoking session: %w", err)
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,133 @@
+package cookie
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	sessions := []*Session{
+		{TokenID: "t1", AccountID: "a1", UserAgent: "firefox", ExpiresTimestamp: now.Add(time.Hour), CreatedTimestamp: now.Add(-2 * time.Minute)},
+		{TokenID: "t2", AccountID: "a1", UserAgent: "chrome", ExpiresTimestamp: now.Add(time.Hour), CreatedTimestamp: now.Add(-time.Minute)},
+		{TokenID: "t3", AccountID: "a1", ExpiresTimestamp: now.Add(-time.Minute)},
+		{TokenID: "t4", AccountID: "a2", ExpiresTimestamp: now.Add(time.Hour)},
+	}
+	for _, s := range sessions {
+		require.NoError(t, store.Save(ctx, s))
+	}
+	assert.Error(t, store.Save(ctx, &Session{}))
+
+	active, err := store.List(ctx, "a1")
+	require.NoError(t, err)
+	require.Len(t, active, 2)
+	assert.Equal(t, "t1", active[0].TokenID)
+	assert.Equal(t, "chrome", active[1].Device().UserAgent)
+
+	require.NoError(t, store.Revoke(ctx, "t1"))
+	_, err = store.Get(ctx, "t1")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	removed, err := store.DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	removed, err = store.RevokeAll(ctx, "a1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	s, err := store.Get(ctx, "t4")
+	require.NoError(t, err)
+	assert.Equal(t, "a2", s.AccountID)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore())
+}
+
+func TestFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(path)
+	require.NoError(t, err)
+	testSessionStore(t, store)
+
+	reopened, err := NewFileSessionStore(path)
+	require.NoError(t, err)
+	_, err = reopened.Get(context.Background(), "t4")
+	assert.NoError(t, err)
+	_, err = reopened.Get(context.Background(), "t2")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestClientSessions(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Sessions: NewMemorySessionStore()}
+	ctx := context.Background()
+
+	login := func(tokenID string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", "test-agent")
+		require.NoError(t, c.SetCookie(r, httptest.NewRecorder(), &Data{UID: "user-1", AccountID: "a1", TokenID: tokenID}, false))
+		return r
+	}
+	first := login("t1")
+	second := login("t2")
+	_, valid := c.HasValidCookie(first)
+	assert.True(t, valid)
+
+	sessions, err := c.ListSessions(ctx, "a1")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "test-agent", sessions[0].Device().UserAgent)
+
+	require.NoError(t, c.RevokeSession(ctx, "t1"))
+	_, valid = c.HasValidCookie(first)
+	assert.False(t, valid, "revoked sessions are rejected")
+	_, valid = c.HasValidCookie(second)
+	assert.True(t, valid)
+
+	logout := login("t3")
+	copied := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range logout.Cookies() {
+		copied.AddCookie(ck)
+	}
+	require.NoError(t, c.SetCookie(logout, httptest.NewRecorder(), nil, true))
+	_, valid = c.HasValidCookie(copied)
+	assert.False(t, valid, "logging out revokes the session of the cookies")
+
+	removed, err := c.RevokeAllSessions(ctx, "a1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, valid = c.HasValidCookie(second)
+	assert.False(t, valid)
+
+	unknown := signedRequest(&Client{DefaultExpiresDuration: time.Hour, Salt: "secret"}, &Data{UID: "user-1", AccountID: "a1", TokenID: "t3"})
+	_, valid = c.HasValidCookie(unknown)
+	assert.False(t, valid, "cookies without a session are rejected")
+
+	_, err = (&Client{}).ListSessions(ctx, "a1")
+	assert.ErrorIs(t, err, ErrNoSessionStore)
+}
+
+func TestGetCookiesSavesSession(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret", Sessions: NewMemorySessionStore()}
+
+	r := signedRequest(c, &Data{UID: "user-1", AccountID: "a1", TokenID: "t1"})
+	_, err := c.Authenticate(r)
+	assert.NoError(t, err)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.SetRequestCookie(r, &Data{UID: "user-1", AccountID: "a1", TokenID: "t2"})
+	_, err = c.Authenticate(r)
+	assert.NoError(t, err)
+
+	sessions, err := c.ListSessions(context.Background(), "a1")
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+}
@@ -0,0 +1,209 @@
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSalt  = "12345678"
+	defaultKeyID = "default"
+	// signatureVersion signs the canonical encoding of every cookie field, see canonicalData.
+	signatureVersion = "v3"
+	// signatureV2 and signatureV1 sign the ambiguous Data.UniqueID, where "-" inside ids moves
+	// between fields. They are only accepted with AllowLegacySignature.
+	signatureV2 = "v2"
+	signatureV1 = "v1"
+)
+
+var ErrInvalidSignature = errors.New("invalid cookie signature")
+
+// Keyring holds the HMAC keys cookies are signed with. New cookies are signed with the active key,
+// retired keys are only used to verify cookies signed before a rotation.
+type Keyring struct {
+	mu       sync.RWMutex
+	activeID string
+	keys     map[string][]byte
+}
+
+func NewKeyring(activeID string, key []byte) *Keyring {
+	return &Keyring{
+		activeID: activeID,
+		keys:     map[string][]byte{activeID: key},
+	}
+}
+
+// ParseKeyring parses "id:secret" values, the first value is the active key.
+func ParseKeyring(values ...string) (*Keyring, error) {
+	var k *Keyring
+	for _, value := range values {
+		id, secret, found := strings.Cut(strings.TrimSpace(value), ":")
+		if !found || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid cookie signing key, expected id:secret")
+		}
+		if strings.Contains(id, ".") {
+			return nil, fmt.Errorf("invalid cookie signing key id %q, ids can not contain '.'", id)
+		}
+		if k == nil {
+			k = NewKeyring(id, []byte(secret))
+			continue
+		}
+		k.Retire(id, []byte(secret))
+	}
+	if k == nil {
+		return nil, fmt.Errorf("no cookie signing keys")
+	}
+	return k, nil
+}
+
+// Retire adds a key that is only used to verify signatures.
+func (k *Keyring) Retire(id string, key []byte) *Keyring {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id != k.activeID {
+		k.keys[id] = key
+	}
+	return k
+}
+
+// Rotate makes key the active key, the previous active key is kept as a retired key.
+func (k *Keyring) Rotate(id string, key []byte) *Keyring {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = key
+	k.activeID = id
+	return k
+}
+
+// Remove drops a retired key, cookies signed with it are no longer valid.
+func (k *Keyring) Remove(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id != k.activeID {
+		delete(k.keys, id)
+	}
+}
+
+func (k *Keyring) ActiveID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.activeID
+}
+
+func (k *Keyring) active() (string, []byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.activeID, k.keys[k.activeID]
+}
+
+func (k *Keyring) key(id string) (key []byte, active bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[id], id == k.activeID
+}
+
+func (c *Client) keyring() *Keyring {
+	if c.Keys != nil {
+		return c.Keys
+	}
+	return NewKeyring(defaultKeyID, []byte(c.Salt))
+}
+
+func signData(version, keyID string, key []byte, cd *Data) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(version + "." + keyID + "."))
+	switch version {
+	case signatureV1:
+		mac.Write([]byte(cd.UniqueID()))
+	case signatureV2:
+		mac.Write([]byte(cd.UniqueID() + "." + cd.DeviceID))
+	default:
+		mac.Write(canonicalData(cd))
+	}
+	return mac.Sum(nil)
+}
+
+// canonicalData encodes the fields stored in cookies with their lengths, so no two different
+// Data have the same encoding. Meta is not part of the multi cookie format and not signed.
+func canonicalData(cd *Data) []byte {
+	var b []byte
+	field := func(value string) {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(value)))
+		b = append(b, value...)
+	}
+	field(cd.UID)
+	field(cd.TokenID)
+	field(cd.AccountID)
+	field(cd.DeviceID)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(cd.Roles)))
+	for _, role := range cd.Roles {
+		field(role)
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(cd.Expires.Unix()))
+	b = binary.BigEndian.AppendUint64(b, uint64(cd.Timestamp.Unix()))
+	return b
+}
+
+// knownVersion reports whether signatures of version are accepted, v1 does not cover the device id
+// and is never accepted while cookies are bound to a device.
+func (c *Client) knownVersion(version string) bool {
+	switch version {
+	case signatureVersion:
+		return true
+	case signatureV2:
+		return c.AllowLegacySignature
+	case signatureV1:
+		return c.AllowLegacySignature && c.binding() == BindNone
+	}
+	return false
+}
+
+func (c *Client) legacySignature(cd *Data) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(cd.UniqueID() + c.Salt))
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// ValidSignature checks signature against cd in constant time. Signatures of retired keys are
+// accepted while RotatingSalt is set, v1 and v2 signatures and the unkeyed sha256 signatures of
+// older versions only with AllowLegacySignature. Signatures without the device id are refused
+// whenever DeviceBinding is set.
+func (c *Client) ValidSignature(cd *Data, signature string) bool {
+	version, rest, found := strings.Cut(signature, ".")
+	if !found {
+		return c.AllowLegacySignature && c.binding() == BindNone && hmac.Equal([]byte(signature), []byte(c.legacySignature(cd)))
+	}
+	if !c.knownVersion(version) {
+		return false
+	}
+	keyID, encoded, found := strings.Cut(rest, ".")
+	if !found {
+		return false
+	}
+	key, active := c.keyring().key(keyID)
+	if key == nil || (!active && !c.RotatingSalt) {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, signData(version, keyID, key, cd))
+}
+
+// SignedWithRetiredKey reports whether signature was made with a key that is no longer active or
+// an older signature version, such cookies should be set again to move them to the active key.
+func (c *Client) SignedWithRetiredKey(signature string) bool {
+	version, rest, found := strings.Cut(signature, ".")
+	if !found || version != signatureVersion {
+		return true
+	}
+	keyID, _, _ := strings.Cut(rest, ".")
+	return keyID != c.keyring().ActiveID()
+}
@@ -0,0 +1,154 @@
+package cookie
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedRequest(c *Client, cd *Data) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range c.GetCookies(r, cd) {
+		r.AddCookie(ck)
+	}
+	return r
+}
+
+func TestSignatureRotation(t *testing.T) {
+	keys, err := ParseKeyring("k1:first-secret")
+	require.NoError(t, err)
+	c := &Client{DefaultExpiresDuration: time.Hour, Keys: keys, RotatingSalt: true}
+
+	old := signedRequest(c, &Data{UID: "user-1", TokenID: "token", Roles: []string{"admin", "user"}})
+	data, valid := c.HasValidCookie(old)
+	require.True(t, valid)
+	assert.Equal(t, []string{"admin", "user"}, data.Roles)
+	assert.True(t, strings.HasPrefix(data.Signature, "v3.k1."))
+	assert.False(t, c.SignedWithRetiredKey(data.Signature))
+
+	keys.Rotate("k2", []byte("second-secret"))
+	_, valid = c.HasValidCookie(old)
+	assert.True(t, valid, "retired keys are accepted while rotating")
+	assert.True(t, c.SignedWithRetiredKey(data.Signature))
+
+	c.RotatingSalt = false
+	_, valid = c.HasValidCookie(old)
+	assert.False(t, valid)
+
+	_, valid = c.HasValidCookie(signedRequest(c, &Data{UID: "user-1", TokenID: "token"}))
+	assert.True(t, valid)
+
+	c.RotatingSalt = true
+	keys.Remove("k1")
+	_, valid = c.HasValidCookie(old)
+	assert.False(t, valid)
+}
+
+func TestValidSignature(t *testing.T) {
+	c := &Client{Salt: "secret"}
+	cd := &Data{UID: "user-1", TokenID: "token", Expires: time.Now().Add(time.Hour)}
+	signature := c.GenerateSignature(cd)
+
+	tests := []struct {
+		name      string
+		signature string
+		legacy    bool
+		want      bool
+	}{
+		{"valid", signature, false, true},
+		{"tampered", signature[:len(signature)-2] + "AA", false, false},
+		{"unknown key", strings.Replace(signature, "default", "other", 1), false, false},
+		{"legacy rejected", c.legacySignature(cd), false, false},
+		{"legacy allowed", c.legacySignature(cd), true, true},
+		{"empty", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.AllowLegacySignature = tt.legacy
+			assert.Equal(t, tt.want, c.ValidSignature(cd, tt.signature))
+		})
+	}
+
+	other := *cd
+	other.UID = "user-2"
+	assert.False(t, c.ValidSignature(&other, signature))
+}
+
+func TestSignatureCoversEveryField(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret"}
+	issued := &Data{UID: "alice-smith", TokenID: "t1", AccountID: "acc", Roles: []string{"a b"}}
+	cookies := c.GetCookies(nil, issued)
+
+	tamper := func(values map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, ck := range cookies {
+			if value, found := values[ck.Name]; found {
+				ck = &http.Cookie{Name: ck.Name, Value: value}
+			}
+			r.AddCookie(ck)
+		}
+		return r
+	}
+	_, err := c.Authenticate(tamper(nil))
+	require.NoError(t, err)
+
+	for name, values := range map[string]map[string]string{
+		"uid into token id": {UID: "alice", TokenID: "smith-t1"},
+		"roles":             {Roles: "a,b"},
+		"timestamp":         {Timestamp: strconv.FormatInt(time.Now().Add(-5*time.Hour).Unix(), 10)},
+		"device id":         {DeviceID: "other"},
+	} {
+		_, err = c.Authenticate(tamper(values))
+		assert.ErrorIs(t, err, ErrInvalidSignature, name)
+	}
+}
+
+func TestLegacySignatureVersions(t *testing.T) {
+	c := &Client{Salt: "secret"}
+	cd := &Data{UID: "user-1", TokenID: "token", Expires: time.Now().Add(time.Hour)}
+	keyID, key := c.keyring().active()
+	for _, version := range []string{signatureV1, signatureV2} {
+		signature := version + "." + keyID + "." + base64.RawURLEncoding.EncodeToString(signData(version, keyID, key, cd))
+		c.AllowLegacySignature = false
+		assert.False(t, c.ValidSignature(cd, signature), version)
+		assert.True(t, c.SignedWithRetiredKey(signature), version)
+		c.AllowLegacySignature = true
+		assert.True(t, c.ValidSignature(cd, signature), version)
+	}
+}
+
+func TestClientValidate(t *testing.T) {
+	assert.Error(t, (&Client{Salt: DefaultSalt}).Validate())
+	assert.Error(t, (&Client{}).Validate())
+	assert.NoError(t, (&Client{Salt: DefaultSalt, DevMode: true}).Validate())
+	assert.NoError(t, (&Client{Salt: "secret"}).Validate())
+	assert.NoError(t, (&Client{Salt: DefaultSalt, Keys: NewKeyring("k1", []byte("secret"))}).Validate())
+
+	_, err := ParseKeyring("missing-secret")
+	assert.Error(t, err)
+	_, err = ParseKeyring("bad.id:secret")
+	assert.Error(t, err)
+}
+
+func TestSkipVerificationInDevMode(t *testing.T) {
+	c := &Client{DefaultExpiresDuration: time.Hour, Salt: "secret"}
+	r := signedRequest(&Client{DefaultExpiresDuration: time.Hour, Salt: "other"}, &Data{UID: "user-1", TokenID: "token"})
+
+	_, valid := c.HasValidCookie(r)
+	assert.False(t, valid, "VerifySignature=false is ignored outside dev mode")
+
+	c.DevMode = true
+	_, valid = c.HasValidCookie(r)
+	assert.True(t, valid)
+
+	c.VerifySignature = true
+	_, valid = c.HasValidCookie(r)
+	assert.False(t, valid)
+}
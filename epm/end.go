@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"github.com/Seann-Moser/rutil"
 	"github.com/Seann-Moser/rutil/rbac"
+	"net"
 	"net/http"
+	"net/url"
+	"reflect"
 	"regexp"
 	"strings"
 )
@@ -22,9 +25,19 @@ type Endpoint struct {
 	RoleAccess  map[string]*Access `rf:"required" json:"role_access"`
 	QueryParams []string           `json:"query_params"`
 	Methods     []string           `rf:"required" json:"methods"`
+	Requests    map[string]*Body   `json:"-"`
+	Responses   map[string]*Body   `json:"-"`
 	f           http.HandlerFunc   `rf:"required"`
 }
 
+// Body is a Go type used as a request or response body of an endpoint.
+// An empty Method applies to every method of the endpoint.
+type Body struct {
+	Method string
+	Status int
+	Type   reflect.Type
+}
+
 type Access struct {
 	Role   *rbac.Role
 	Access int
@@ -58,19 +71,20 @@ func (e *Endpoint) AddRoles(access int, roles ...*rbac.Role) *Endpoint {
 }
 
 func (e *Endpoint) SetPath(path string) *Endpoint {
-	// Step 1: Set e.Path
 	e.Path = path
+	return e
+}
 
-	// Step 2: Extract all values between {}
-	matches := endpointVarIDsRe.FindAllStringSubmatch(path, -1)
-
-	// Step 3: Add them to the global EndpointVarIDs
-	for _, match := range matches {
-		if len(match) > 1 {
-			EndpointVarIDs[match[1]] = match[1]
+// pathVarIDs returns the names of the {var} and {var...} wildcards in path.
+func pathVarIDs(path string) []string {
+	var output []string
+	for _, match := range endpointVarIDsRe.FindAllStringSubmatch(path, -1) {
+		name := strings.TrimSuffix(match[1], "...")
+		if name != "$" {
+			output = append(output, name)
 		}
 	}
-	return e
+	return output
 }
 
 func (e *Endpoint) SetMethods(methods ...string) *Endpoint {
@@ -78,21 +92,164 @@ func (e *Endpoint) SetMethods(methods ...string) *Endpoint {
 	return e
 }
 
-// todo SetResponse
+// SetResponse records the type of t as the response body returned with status for the given methods,
+// or for every method of the endpoint when none are given.
 func (e *Endpoint) SetResponse(status int, t interface{}, method ...string) *Endpoint {
+	if e.Responses == nil {
+		e.Responses = map[string]*Body{}
+	}
+	for _, m := range bodyMethods(method) {
+		e.Responses[bodyKey(m, status)] = &Body{Method: m, Status: status, Type: reflect.TypeOf(t)}
+	}
 	return e
 }
 
-// todo SetRequest
+// SetRequest records the type of t as the request body for the given methods,
+// or for every method of the endpoint when none are given. The status is kept for
+// symmetry with SetResponse and is the status expected on success.
 func (e *Endpoint) SetRequest(status int, t interface{}, method ...string) *Endpoint {
+	if e.Requests == nil {
+		e.Requests = map[string]*Body{}
+	}
+	for _, m := range bodyMethods(method) {
+		e.Requests[m] = &Body{Method: m, Status: status, Type: reflect.TypeOf(t)}
+	}
 	return e
 }
 
-// todo Equal
+// GetRequest returns the request body recorded for method, falling back to the one set for every method.
+func (e *Endpoint) GetRequest(method string) *Body {
+	if b, found := e.Requests[strings.ToUpper(method)]; found {
+		return b
+	}
+	return e.Requests[""]
+}
+
+// GetResponses returns the response bodies recorded for method keyed by status.
+// Method specific responses override the ones set for every method.
+func (e *Endpoint) GetResponses(method string) map[int]*Body {
+	output := map[int]*Body{}
+	for _, b := range e.Responses {
+		if b.Method == "" {
+			output[b.Status] = b
+		}
+	}
+	for _, b := range e.Responses {
+		if b.Method == strings.ToUpper(method) {
+			output[b.Status] = b
+		}
+	}
+	return output
+}
+
+func bodyMethods(method []string) []string {
+	if len(method) == 0 {
+		return []string{""}
+	}
+	var output []string
+	for _, m := range method {
+		output = append(output, strings.ToUpper(m))
+	}
+	return output
+}
+
+func bodyKey(method string, status int) string {
+	return fmt.Sprintf("%s %d", method, status)
+}
+
+// Equal reports whether the request matches the methods and path template of the endpoint.
 func (e *Endpoint) Equal(r *http.Request) bool {
+	_, ok := e.Match(r)
+	return ok
+}
+
+// Match matches the request against the endpoint the same way http.ServeMux matches patterns
+// and returns the values of the {var} and {var...} wildcards in the path.
+// An endpoint without methods matches every method and GET also matches HEAD.
+func (e *Endpoint) Match(r *http.Request) (map[string]string, bool) {
+	if r == nil || r.URL == nil || !methodMatches(e.Methods, r.Method) {
+		return nil, false
+	}
+	pattern := e.Path
+	if i := strings.Index(pattern, "/"); i > 0 {
+		if !strings.EqualFold(pattern[:i], stripHostPort(r.Host)) {
+			return nil, false
+		}
+		pattern = pattern[i:]
+	} else if i < 0 {
+		return nil, false
+	}
+	vars, ok := matchPath(pattern, r.URL.EscapedPath())
+	if !ok {
+		return nil, false
+	}
+	return vars, true
+}
+
+func methodMatches(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) || (strings.EqualFold(m, http.MethodGet) && method == http.MethodHead) {
+			return true
+		}
+	}
 	return false
 }
 
+func matchPath(pattern, escapedPath string) (map[string]string, bool) {
+	vars := map[string]string{}
+	patternSegments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.TrimPrefix(escapedPath, "/"), "/")
+	for i, seg := range patternSegments {
+		last := i == len(patternSegments)-1
+		switch {
+		case last && seg == "":
+			// a trailing slash matches every path below it
+			return vars, len(pathSegments) > i
+		case last && seg == "{$}":
+			return vars, len(pathSegments) == i+1 && pathSegments[i] == ""
+		case i >= len(pathSegments):
+			return nil, false
+		}
+
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := seg[1 : len(seg)-1]
+			if strings.HasSuffix(name, "...") {
+				v, err := url.PathUnescape(strings.Join(pathSegments[i:], "/"))
+				if err != nil {
+					return nil, false
+				}
+				vars[strings.TrimSuffix(name, "...")] = v
+				return vars, true
+			}
+			v, err := url.PathUnescape(pathSegments[i])
+			if err != nil || v == "" {
+				return nil, false
+			}
+			vars[name] = v
+			continue
+		}
+
+		v, err := url.PathUnescape(pathSegments[i])
+		if err != nil {
+			return nil, false
+		}
+		if literal, err := url.PathUnescape(seg); err != nil || literal != v {
+			return nil, false
+		}
+	}
+	return vars, len(pathSegments) == len(patternSegments)
+}
+
+func stripHostPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
 func (e *Endpoint) SetFunc(f *http.HandlerFunc) bool {
 	e.f = *f
 	return false
@@ -102,6 +259,9 @@ func (e *Endpoint) Valid() error {
 	return rutil.CheckRequiredFields[Endpoint](*e)
 }
 
+// AddToRoute registers the endpoint on mux and adds its path variables to the global
+// EndpointVarIDs used by GetRawPath. Endpoints registered on a Router only use the
+// path variables of the router.
 func (e *Endpoint) AddToRoute(ctx context.Context, mux *http.ServeMux, NextSteps ...NextStep) error {
 	for _, m := range e.Methods {
 		if e.f != nil {
@@ -111,6 +271,9 @@ func (e *Endpoint) AddToRoute(ctx context.Context, mux *http.ServeMux, NextSteps
 		}
 
 	}
+	for _, name := range pathVarIDs(e.Path) {
+		EndpointVarIDs[name] = name
+	}
 
 	for _, next := range NextSteps {
 		err := next(ctx, e)
@@ -105,3 +105,41 @@ func TestEndpointValid(t *testing.T) {
 		}
 	}
 }
+
+func TestEndpointMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		methods  []string
+		method   string
+		url      string
+		wantVars map[string]string
+		wantOK   bool
+	}{
+		{"exact", "/health", []string{http.MethodGet}, http.MethodGet, "/health", map[string]string{}, true},
+		{"head matches get", "/health", []string{http.MethodGet}, http.MethodHead, "/health", map[string]string{}, true},
+		{"wrong method", "/health", []string{http.MethodGet}, http.MethodPost, "/health", nil, false},
+		{"any method", "/health", nil, http.MethodDelete, "/health", map[string]string{}, true},
+		{"var", "/items/{id}/tags/{tag}", []string{"get"}, http.MethodGet, "/items/1/tags/a%2Fb", map[string]string{"id": "1", "tag": "a/b"}, true},
+		{"var missing segment", "/items/{id}", []string{http.MethodGet}, http.MethodGet, "/items/", nil, false},
+		{"var extra segment", "/items/{id}", []string{http.MethodGet}, http.MethodGet, "/items/1/2", nil, false},
+		{"remainder", "/files/{path...}", []string{http.MethodGet}, http.MethodGet, "/files/a/b/c.txt", map[string]string{"path": "a/b/c.txt"}, true},
+		{"empty remainder", "/files/{path...}", []string{http.MethodGet}, http.MethodGet, "/files/", map[string]string{"path": ""}, true},
+		{"trailing slash prefix", "/static/", []string{http.MethodGet}, http.MethodGet, "/static/css/site.css", map[string]string{}, true},
+		{"trailing slash not without slash", "/static/", []string{http.MethodGet}, http.MethodGet, "/static", nil, false},
+		{"end anchor", "/items/{$}", []string{http.MethodGet}, http.MethodGet, "/items/", map[string]string{}, true},
+		{"end anchor extra", "/items/{$}", []string{http.MethodGet}, http.MethodGet, "/items/1", nil, false},
+		{"host", "example.com/items", []string{http.MethodGet}, http.MethodGet, "http://example.com:8080/items", map[string]string{}, true},
+		{"other host", "example.com/items", []string{http.MethodGet}, http.MethodGet, "http://other.com/items", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Endpoint{Path: tt.path, Methods: tt.methods}
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			vars, ok := e.Match(req)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantOK, e.Equal(req))
+			assert.Equal(t, tt.wantVars, vars)
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package epm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Seann-Moser/rutil/rbac"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OpenAPIVersion       = "3.1.0"
+	OpenAPISecurityName  = "cookieAuth"
+	openAPISchemaRefPath = "#/components/schemas/"
+)
+
+var schemaNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type OpenAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+
+	schemaTypes map[reflect.Type]string
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// NewOpenAPI generates an OpenAPI 3.1 document for the endpoints.
+// Path variables are taken from the {} segments of Endpoint.Path and the roles in
+// Endpoint.RoleAccess that grant a method are listed as its security requirement.
+func NewOpenAPI(info OpenAPIInfo, endpoints ...*Endpoint) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI:     OpenAPIVersion,
+		Info:        info,
+		Paths:       map[string]map[string]*Operation{},
+		schemaTypes: map[reflect.Type]string{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{
+				OpenAPISecurityName: {Type: "apiKey", In: "cookie", Name: "signature"},
+			},
+		},
+	}
+	for _, e := range endpoints {
+		doc.addEndpoint(e)
+	}
+	return doc
+}
+
+func (o *OpenAPI) JSON() ([]byte, error) {
+	return json.MarshalIndent(o, "", "    ")
+}
+
+func (o *OpenAPI) YAML() ([]byte, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err = json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+// Handler serves the document as JSON, or as YAML when requested with ?format=yaml,
+// a .yaml/.yml path or an Accept header asking for yaml.
+func (o *OpenAPI) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			b           []byte
+			err         error
+			contentType = "application/json"
+		)
+		if wantsYAML(r) {
+			contentType = "application/yaml"
+			b, err = o.YAML()
+		} else {
+			b, err = o.JSON()
+		}
+		if err != nil {
+			http.Error(w, "failed encoding openapi document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}
+}
+
+func wantsYAML(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return strings.EqualFold(f, "yaml") || strings.EqualFold(f, "yml")
+	}
+	if strings.HasSuffix(r.URL.Path, ".yaml") || strings.HasSuffix(r.URL.Path, ".yml") {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "yaml")
+}
+
+func (o *OpenAPI) addEndpoint(e *Endpoint) {
+	path, pathVars := openAPIPath(e.Path)
+	item, found := o.Paths[path]
+	if !found {
+		item = map[string]*Operation{}
+		o.Paths[path] = item
+	}
+	for _, method := range e.Methods {
+		method = strings.ToUpper(method)
+		op := &Operation{
+			OperationID: operationID(e, method),
+			Summary:     e.Name,
+			Responses:   map[string]*Response{},
+		}
+		for _, v := range pathVars {
+			op.Parameters = append(op.Parameters, &Parameter{Name: v, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		for _, q := range e.QueryParams {
+			op.Parameters = append(op.Parameters, &Parameter{Name: q, In: "query", Schema: &Schema{Type: "string"}})
+		}
+		if body := e.GetRequest(method); body != nil && body.Type != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{"application/json": {Schema: o.schema(body.Type)}},
+			}
+		}
+		for status, body := range e.GetResponses(method) {
+			resp := &Response{Description: http.StatusText(status)}
+			if body.Type != nil {
+				resp.Content = map[string]*MediaType{"application/json": {Schema: o.schema(body.Type)}}
+			}
+			op.Responses[strconv.Itoa(status)] = resp
+		}
+		if len(op.Responses) == 0 {
+			op.Responses["default"] = &Response{Description: "response"}
+		}
+		if roles := rolesForMethod(e, method); len(roles) > 0 {
+			op.Security = []map[string][]string{{OpenAPISecurityName: roles}}
+		}
+		item[strings.ToLower(method)] = op
+	}
+}
+
+// openAPIPath converts a ServeMux pattern path into an OpenAPI path and returns its variables.
+func openAPIPath(path string) (string, []string) {
+	var vars []string
+	output := endpointVarIDsRe.ReplaceAllStringFunc(path, func(s string) string {
+		name := strings.TrimSuffix(strings.Trim(s, "{}"), "...")
+		if name == "$" {
+			return ""
+		}
+		vars = append(vars, name)
+		return "{" + name + "}"
+	})
+	return output, vars
+}
+
+func operationID(e *Endpoint, method string) string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s_%s", e.Name, strings.ToLower(method))
+	}
+	return strings.ToLower(method) + rbac.URLToResourceID(e.Path)
+}
+
+func rolesForMethod(e *Endpoint, method string) []string {
+	code := rbac.HTTPMethodToAccessCode(method)
+	var roles []string
+	for _, access := range e.RoleAccess {
+		if access == nil || access.Role == nil {
+			continue
+		}
+		if access.Access == 0 || rbac.HasAccess(access.Access, code) {
+			roles = append(roles, access.Role.Name)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (o *OpenAPI) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: o.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: o.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return o.structSchema(t)
+		}
+		name, found := o.schemaTypes[t]
+		if !found {
+			name = o.schemaName(t)
+			// register before walking the fields so recursive types resolve to a $ref
+			o.schemaTypes[t] = name
+			o.Components.Schemas[name] = &Schema{}
+			*o.Components.Schemas[name] = *o.structSchema(t)
+		}
+		return &Schema{Ref: openAPISchemaRefPath + name}
+	}
+	return &Schema{}
+}
+
+// schemaName uses the type name and falls back to the package qualified name on collisions.
+func (o *OpenAPI) schemaName(t reflect.Type) string {
+	name := schemaNameRe.ReplaceAllString(t.Name(), "_")
+	if _, taken := o.Components.Schemas[name]; !taken {
+		return name
+	}
+	return schemaNameRe.ReplaceAllString(t.PkgPath()+"."+t.Name(), "_")
+}
+
+// structSchema promotes the fields of embedded structs level by level like encoding/json,
+// a shallower field wins a name over deeper ones and every embedded type is only walked once.
+func (o *OpenAPI) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	visited := map[reflect.Type]bool{}
+	for current := []reflect.Type{t}; len(current) > 0; {
+		var next []reflect.Type
+		for _, st := range current {
+			if visited[st] {
+				continue
+			}
+			visited[st] = true
+			next = append(next, o.addStructFields(s, st)...)
+		}
+		current = next
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// addStructFields adds the fields of t not already in s and returns the embedded structs.
+func (o *OpenAPI) addStructFields(s *Schema, t reflect.Type) []reflect.Type {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, taken := s.Properties[name]; taken {
+			continue
+		}
+		s.Properties[name] = o.schema(field.Type)
+		if field.Tag.Get("rf") == "required" {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return embedded
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	return strings.Split(tag, ",")[0], false
+}
@@ -0,0 +1,113 @@
+package epm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Seann-Moser/rutil/rbac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPIItem struct {
+	ID       string            `json:"id" rf:"required"`
+	Created  time.Time         `json:"created"`
+	Tags     []string          `json:"tags,omitempty"`
+	Meta     map[string]string `json:"meta"`
+	Children []*openAPIItem    `json:"children"`
+	internal string
+}
+
+func TestNewOpenAPI(t *testing.T) {
+	reader := &rbac.Role{ID: "r1", Name: "reader"}
+	writer := &rbac.Role{ID: "r2", Name: "writer"}
+	e := &Endpoint{Name: "items"}
+	e.SetPath("/api/v1/items/{id}/{rest...}").
+		SetMethods(http.MethodGet, http.MethodPost).
+		AddQueryParams("filter").
+		AddRoles(rbac.AccessRead, reader).
+		AddRoles(rbac.AccessWrite, writer).
+		SetRequest(http.StatusCreated, openAPIItem{}, http.MethodPost).
+		SetResponse(http.StatusOK, []openAPIItem{}).
+		SetResponse(http.StatusCreated, &openAPIItem{}, http.MethodPost)
+
+	doc := NewOpenAPI(OpenAPIInfo{Title: "test", Version: "1.0.0"}, e)
+	item, found := doc.Paths["/api/v1/items/{id}/{rest}"]
+	require.True(t, found)
+
+	get := item["get"]
+	require.NotNil(t, get)
+	assert.Nil(t, get.RequestBody)
+	assert.Len(t, get.Parameters, 3)
+	assert.Equal(t, []map[string][]string{{OpenAPISecurityName: {"reader"}}}, get.Security)
+	assert.Contains(t, get.Responses, "200")
+	assert.NotContains(t, get.Responses, "201")
+
+	post := item["post"]
+	require.NotNil(t, post)
+	require.NotNil(t, post.RequestBody)
+	assert.Equal(t, "#/components/schemas/openAPIItem", post.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, post.Responses, "200")
+	assert.Contains(t, post.Responses, "201")
+	assert.Equal(t, []map[string][]string{{OpenAPISecurityName: {"writer"}}}, post.Security)
+
+	schema := doc.Components.Schemas["openAPIItem"]
+	require.NotNil(t, schema)
+	assert.Equal(t, []string{"id"}, schema.Required)
+	assert.Equal(t, "date-time", schema.Properties["created"].Format)
+	assert.Equal(t, "#/components/schemas/openAPIItem", schema.Properties["children"].Items.Ref)
+	assert.NotContains(t, schema.Properties, "internal")
+}
+
+type OpenAPIBase struct {
+	Name string `json:"name"`
+	ID   string `json:"id" rf:"required"`
+	OpenAPIDeep
+}
+
+type OpenAPIDeep struct {
+	ID    int    `json:"id"`
+	Depth string `json:"depth" rf:"required"`
+}
+
+type OpenAPINode struct {
+	*OpenAPINode
+	OpenAPIBase
+	Name int `json:"name"`
+}
+
+func TestOpenAPIEmbedded(t *testing.T) {
+	e := &Endpoint{Name: "nodes"}
+	e.SetPath("/api/v1/nodes").
+		SetMethods(http.MethodGet).
+		SetResponse(http.StatusOK, OpenAPINode{})
+
+	doc := NewOpenAPI(OpenAPIInfo{Title: "test", Version: "1.0.0"}, e)
+	schema := doc.Components.Schemas["OpenAPINode"]
+	require.NotNil(t, schema)
+	assert.Equal(t, "integer", schema.Properties["name"].Type, "the outer field wins over the embedded one")
+	assert.Equal(t, "string", schema.Properties["id"].Type, "the shallower embedded field wins")
+	assert.Equal(t, "string", schema.Properties["depth"].Type)
+	assert.Equal(t, []string{"depth", "id"}, schema.Required)
+	assert.Len(t, schema.Properties, 3)
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	e := (&Endpoint{}).SetPath("/health").SetMethods(http.MethodGet)
+	h := NewOpenAPI(OpenAPIInfo{Title: "test", Version: "1.0.0"}, e).Handler()
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, OpenAPIVersion, doc["openapi"])
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "openapi: 3.1.0")
+}
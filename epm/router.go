@@ -0,0 +1,282 @@
+package epm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/multierr"
+)
+
+type Middleware func(next http.Handler) http.Handler
+
+// Router owns a collection of endpoints registered on a http.ServeMux.
+// Groups created with Group share the endpoints, mux and path variables of their parent
+// but add a path prefix and their own middleware chain.
+type Router struct {
+	prefix     string
+	middleware []Middleware
+	state      *routerState
+}
+
+type routerState struct {
+	mu        sync.RWMutex
+	mux       *http.ServeMux
+	endpoints []*Endpoint
+	routes    map[string]string
+	patterns  map[string]*Endpoint
+	varIDs    map[string]string
+}
+
+// NewRouter creates a router on mux, a new http.ServeMux is used when mux is nil.
+// The path variables of the router are not added to the global EndpointVarIDs, use
+// Router.GetRawPath instead of GetRawPath to resolve the route of a request.
+func NewRouter(mux *http.ServeMux) *Router {
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	return &Router{
+		state: &routerState{
+			mux:      mux,
+			routes:   map[string]string{},
+			patterns: map[string]*Endpoint{},
+			varIDs:   map[string]string{},
+		},
+	}
+}
+
+// Group returns a router registering endpoints under prefix. Middleware of the parent
+// runs before the middleware of the group.
+func (rt *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		prefix:     joinRoutePath(rt.prefix, prefix),
+		middleware: append(append([]Middleware{}, rt.middleware...), middleware...),
+		state:      rt.state,
+	}
+}
+
+// Use adds middleware to the router, it only applies to endpoints registered afterwards.
+func (rt *Router) Use(middleware ...Middleware) *Router {
+	rt.middleware = append(rt.middleware, middleware...)
+	return rt
+}
+
+// Handle registers the endpoints. The router keeps a copy of every endpoint with the group
+// prefix applied to its path. Registering a method and path that is already taken, including
+// the same path with differently named variables, returns an error. Every endpoint is checked
+// before any is registered, so a failing Handle leaves the router unchanged. Routes added to
+// the mux without the router are not known to it, a conflict with one of them is only found
+// while registering and keeps the endpoints registered before it. Use a mux that only the
+// router registers on to keep Handle atomic.
+func (rt *Router) Handle(endpoints ...*Endpoint) error {
+	rt.state.mu.Lock()
+	defer rt.state.mu.Unlock()
+	scratch := http.NewServeMux()
+	for pattern := range rt.state.patterns {
+		scratch.Handle(pattern, http.NotFoundHandler())
+	}
+	pending := map[string]string{}
+	registrations := make([]*registration, 0, len(endpoints))
+	for _, e := range endpoints {
+		reg, err := rt.prepare(e, scratch, pending)
+		if err != nil {
+			return err
+		}
+		registrations = append(registrations, reg)
+	}
+	for _, reg := range registrations {
+		if err := rt.register(reg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registration is an endpoint checked by prepare and ready to be added to the mux.
+type registration struct {
+	endpoint *Endpoint
+	handler  http.Handler
+	patterns []string
+}
+
+// prepare validates e against the registered routes and the pending ones of the same Handle
+// call. The patterns are added to scratch, a copy of the mux, to find overlapping wildcards
+// without touching the mux of the router.
+func (rt *Router) prepare(e *Endpoint, scratch *http.ServeMux, pending map[string]string) (*registration, error) {
+	if e == nil {
+		return nil, fmt.Errorf("invalid endpoint")
+	}
+	if e.f == nil {
+		return nil, fmt.Errorf("endpoint does not have router function '%s' ", e.Path)
+	}
+	if len(e.Methods) == 0 {
+		return nil, fmt.Errorf("endpoint does not have any methods '%s'", e.Path)
+	}
+	c := *e
+	c.Path = joinRoutePath(rt.prefix, e.Path)
+
+	var handler http.Handler = c.f
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		handler = rt.middleware[i](handler)
+	}
+	reg := &registration{endpoint: &c, handler: handler}
+	seen := map[string]bool{}
+	for _, m := range c.Methods {
+		m = strings.ToUpper(m)
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		key := routeKey(m, c.Path)
+		if existing, found := rt.state.routes[key]; found {
+			return nil, fmt.Errorf("route '%s %s' conflicts with '%s'", m, c.Path, existing)
+		}
+		if existing, found := pending[key]; found {
+			return nil, fmt.Errorf("route '%s %s' conflicts with '%s'", m, c.Path, existing)
+		}
+		pattern := fmt.Sprintf("%s %s", m, c.Path)
+		if err := registerPattern(scratch, pattern, handler); err != nil {
+			return nil, err
+		}
+		pending[key] = pattern
+		reg.patterns = append(reg.patterns, pattern)
+	}
+	return reg, nil
+}
+
+// register adds a prepared endpoint to the mux and the state of the router.
+func (rt *Router) register(reg *registration) error {
+	for _, pattern := range reg.patterns {
+		if err := registerPattern(rt.state.mux, pattern, reg.handler); err != nil {
+			return err
+		}
+		method, _, _ := strings.Cut(pattern, " ")
+		rt.state.routes[routeKey(method, reg.endpoint.Path)] = pattern
+		rt.state.patterns[pattern] = reg.endpoint
+	}
+
+	for _, name := range pathVarIDs(reg.endpoint.Path) {
+		rt.state.varIDs[name] = name
+	}
+	rt.state.endpoints = append(rt.state.endpoints, reg.endpoint)
+	return nil
+}
+
+// registerPattern converts the panic raised by http.ServeMux on conflicting patterns into an error.
+func registerPattern(mux *http.ServeMux, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed registering route '%s': %v", pattern, r)
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.state.mux.ServeHTTP(w, r)
+}
+
+func (rt *Router) Mux() *http.ServeMux {
+	return rt.state.mux
+}
+
+// Endpoints returns every endpoint registered on the router or any of its groups.
+func (rt *Router) Endpoints() []*Endpoint {
+	rt.state.mu.RLock()
+	defer rt.state.mu.RUnlock()
+	return append([]*Endpoint{}, rt.state.endpoints...)
+}
+
+// Routes returns the sorted "METHOD /path" patterns registered on the router.
+func (rt *Router) Routes() []string {
+	rt.state.mu.RLock()
+	defer rt.state.mu.RUnlock()
+	var output []string
+	for _, pattern := range rt.state.routes {
+		output = append(output, pattern)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// VarIDs returns the path variable names used by the endpoints of the router.
+func (rt *Router) VarIDs() []string {
+	rt.state.mu.RLock()
+	defer rt.state.mu.RUnlock()
+	output := make([]string, 0, len(rt.state.varIDs))
+	for k := range rt.state.varIDs {
+		output = append(output, k)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// GetRawPath is GetRawPath limited to the path variables of the router.
+func (rt *Router) GetRawPath(r *http.Request) (map[string]string, string) {
+	vars := rt.VarIDs()
+	if len(vars) == 0 {
+		return map[string]string{}, r.URL.Path
+	}
+	return GetRawPath(r, vars...)
+}
+
+// Lookup returns the endpoint the mux routes the request to and the values of its path variables.
+func (rt *Router) Lookup(r *http.Request) (*Endpoint, map[string]string, bool) {
+	_, pattern := rt.state.mux.Handler(r)
+	rt.state.mu.RLock()
+	e, found := rt.state.patterns[pattern]
+	rt.state.mu.RUnlock()
+	if !found {
+		return nil, nil, false
+	}
+	vars, ok := e.Match(r)
+	if !ok {
+		return nil, nil, false
+	}
+	return e, vars, true
+}
+
+// RunNextSteps runs every step on every registered endpoint and returns the combined errors.
+func (rt *Router) RunNextSteps(ctx context.Context, steps ...NextStep) error {
+	var err error
+	for _, e := range rt.Endpoints() {
+		for _, next := range steps {
+			if stepErr := next(ctx, e); stepErr != nil {
+				err = multierr.Append(err, fmt.Errorf("endpoint next '%s' failed: %w", e.Path, stepErr))
+			}
+		}
+	}
+	return err
+}
+
+// OpenAPI generates an OpenAPI document for the registered endpoints.
+func (rt *Router) OpenAPI(info OpenAPIInfo) *OpenAPI {
+	return NewOpenAPI(info, rt.Endpoints()...)
+}
+
+func routeKey(method, path string) string {
+	return method + " " + endpointVarIDsRe.ReplaceAllStringFunc(path, func(s string) string {
+		if strings.HasSuffix(s, "...}") {
+			return "{...}"
+		}
+		if s == "{$}" {
+			return s
+		}
+		return "{}"
+	})
+}
+
+func joinRoutePath(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return path
+	}
+	if path == "" || path == "/" {
+		return prefix + "/"
+	}
+	return prefix + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,166 @@
+package epm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEndpoint(path string, methods ...string) *Endpoint {
+	e := &Endpoint{Path: path, Methods: methods}
+	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	e.SetFunc(&f)
+	return e
+}
+
+func headerMiddleware(value string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRouterGroups(t *testing.T) {
+	router := NewRouter(nil).Use(headerMiddleware("root"))
+	api := router.Group("/api/v1/", headerMiddleware("api"))
+	require.NoError(t, api.Handle(newTestEndpoint("/items/{item_id}", http.MethodGet, http.MethodPost)))
+	require.NoError(t, router.Handle(newTestEndpoint("/health", http.MethodGet)))
+
+	assert.Equal(t, []string{"GET /api/v1/items/{item_id}", "GET /health", "POST /api/v1/items/{item_id}"}, router.Routes())
+	assert.Equal(t, []string{"item_id"}, api.VarIDs())
+	require.Len(t, router.Endpoints(), 2)
+	assert.Equal(t, "/api/v1/items/{item_id}", router.Endpoints()[0].Path)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/items/123", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"root", "api"}, w.Header().Values("X-Chain"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, []string{"root"}, w.Header().Values("X-Chain"))
+
+	var rawPath string
+	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, rawPath = router.GetRawPath(r)
+	})
+	e := newTestEndpoint("/users/{user_id}", http.MethodGet)
+	e.SetFunc(&f)
+	require.NoError(t, api.Handle(e))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/users/abc", nil))
+	assert.Equal(t, "/api/v1/users/{user_id}", rawPath)
+}
+
+func TestRouterConflicts(t *testing.T) {
+	router := NewRouter(nil)
+	require.NoError(t, router.Handle(newTestEndpoint("/items/{id}", http.MethodGet)))
+
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		wantErr  bool
+	}{
+		{"duplicate", newTestEndpoint("/items/{id}", http.MethodGet), true},
+		{"renamed variable", newTestEndpoint("/items/{item_id}", "get"), true},
+		{"ambiguous pattern", newTestEndpoint("/{group}/abc", http.MethodGet), true},
+		{"more specific pattern", newTestEndpoint("/items/abc", http.MethodGet), false},
+		{"other method", newTestEndpoint("/items/{id}", http.MethodDelete), false},
+		{"missing func", &Endpoint{Path: "/missing", Methods: []string{http.MethodGet}}, true},
+		{"missing methods", newTestEndpoint("/missing"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := router.Handle(tt.endpoint)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRouterHandleIsAtomic(t *testing.T) {
+	router := NewRouter(nil)
+	require.NoError(t, router.Handle(newTestEndpoint("/items/{id}", http.MethodGet)))
+
+	tests := []struct {
+		name      string
+		endpoints []*Endpoint
+	}{
+		{"conflicting method", []*Endpoint{newTestEndpoint("/users", http.MethodGet), newTestEndpoint("/items/{item_id}", http.MethodPost, http.MethodGet)}},
+		{"overlapping wildcard", []*Endpoint{newTestEndpoint("/users", http.MethodGet), newTestEndpoint("/{group}/abc", http.MethodGet)}},
+		{"conflict within the call", []*Endpoint{newTestEndpoint("/users/{id}", http.MethodGet), newTestEndpoint("/users/{user_id}", http.MethodGet)}},
+		{"invalid endpoint", []*Endpoint{newTestEndpoint("/users", http.MethodGet), newTestEndpoint("/missing")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, router.Handle(tt.endpoints...))
+			assert.Equal(t, []string{"GET /items/{id}"}, router.Routes())
+			assert.Len(t, router.Endpoints(), 1)
+			assert.Equal(t, []string{"id"}, router.VarIDs())
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+			assert.Equal(t, http.StatusNotFound, w.Code, "the mux is unchanged")
+		})
+	}
+	require.NoError(t, router.Handle(newTestEndpoint("/users", http.MethodGet), newTestEndpoint("/items/abc", http.MethodPost)))
+}
+
+func TestRouterKeepsGlobalVarIDs(t *testing.T) {
+	router := NewRouter(nil)
+	require.NoError(t, router.Handle(newTestEndpoint("/routers/{router_id}/{rest...}", http.MethodGet).SetPath("/routers/{router_id}/{rest...}")))
+	assert.Equal(t, []string{"rest", "router_id"}, router.VarIDs())
+	assert.NotContains(t, EndpointVarIDs, "router_id")
+
+	e := newTestEndpoint("/muxes/{mux_id}/{rest...}", http.MethodGet)
+	require.NoError(t, e.AddToRoute(context.Background(), http.NewServeMux()))
+	assert.Equal(t, "mux_id", EndpointVarIDs["mux_id"])
+	assert.Equal(t, "rest", EndpointVarIDs["rest"])
+}
+
+func TestRouterRunNextSteps(t *testing.T) {
+	router := NewRouter(nil)
+	require.NoError(t, router.Handle(newTestEndpoint("/a", http.MethodGet), newTestEndpoint("/b", http.MethodGet)))
+
+	var paths []string
+	err := router.RunNextSteps(context.Background(), func(ctx context.Context, e *Endpoint) error {
+		paths = append(paths, e.Path)
+		if e.Path == "/a" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/a", "/b"}, paths)
+}
+
+func TestRouterLookup(t *testing.T) {
+	router := NewRouter(nil)
+	require.NoError(t, router.Handle(
+		newTestEndpoint("/items/{id}", http.MethodGet),
+		newTestEndpoint("/items/latest", http.MethodGet),
+	))
+
+	e, vars, ok := router.Lookup(httptest.NewRequest(http.MethodGet, "/items/42", nil))
+	require.True(t, ok)
+	assert.Equal(t, "/items/{id}", e.Path)
+	assert.Equal(t, map[string]string{"id": "42"}, vars)
+
+	e, _, ok = router.Lookup(httptest.NewRequest(http.MethodGet, "/items/latest", nil))
+	require.True(t, ok)
+	assert.Equal(t, "/items/latest", e.Path)
+
+	_, _, ok = router.Lookup(httptest.NewRequest(http.MethodPost, "/items/42", nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,120 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Seann-Moser/rutil/auth"
+	cookie "github.com/Seann-Moser/rutil/cook"
+	"github.com/Seann-Moser/rutil/epm"
+	"github.com/Seann-Moser/rutil/pkg/pagination"
+	"github.com/Seann-Moser/rutil/rbac"
+)
+
+type principalContextKey struct{}
+
+// Principal is the authorized caller of a request, stored in the request context by Authorize.
+type Principal struct {
+	UserID     string       `json:"user_id"`
+	AccountID  string       `json:"account_id"`
+	Roles      []string     `json:"roles"`
+	ResourceID string       `json:"resource_id"`
+	Access     int          `json:"access"`
+	Carrier    auth.Carrier `json:"carrier"`
+	Cookie     *cookie.Data `json:"-"`
+}
+
+// PathResolver returns the path values of a request and its path with the values replaced
+// by their {var} names, such as epm.GetRawPath or epm.Router.GetRawPath.
+type PathResolver func(r *http.Request) (map[string]string, string)
+
+// MuxPaths resolves the route pattern of a request with mux.Handler, so Authorize can wrap the
+// whole mux instead of the handlers registered on it. Requests without a route keep their path.
+func MuxPaths(mux *http.ServeMux) PathResolver {
+	return func(r *http.Request) (map[string]string, string) {
+		_, pattern := mux.Handler(r)
+		if _, path, found := strings.Cut(pattern, " "); found {
+			pattern = path
+		}
+		vars, ok := (&epm.Endpoint{Path: pattern}).Match(r)
+		if !ok {
+			return map[string]string{}, r.URL.Path
+		}
+		return vars, patternVarRe.ReplaceAllStringFunc(pattern[strings.Index(pattern, "/"):], func(s string) string {
+			if s == "{$}" {
+				return ""
+			}
+			return "{" + strings.TrimSuffix(strings.Trim(s, "{}"), "...") + "}"
+		})
+	}
+}
+
+var patternVarRe = regexp.MustCompile(`{[^}]+}`)
+
+// Authorize checks every request against rbac using the signed cookie or bearer token of the caller.
+// The resource is resolved from the route pattern with paths, epm.GetRawPath when nil, so the
+// middleware has to wrap handlers registered on a http.ServeMux for the path values to be populated.
+// When it wraps the mux itself the path values are not populated yet, use MuxPaths there or the
+// raw URL is checked instead of the route pattern, which denies {var...} routes and values with dots.
+// Unauthenticated requests get a 401, requests without access a 403 and failing rbac lookups a 500.
+func Authorize(rba rbac.RBAC, c *cookie.Client, paths PathResolver) func(next http.Handler) http.Handler {
+	return AuthorizeWith(rba, auth.New(c, nil), paths)
+}
+
+// AuthorizeWith is Authorize with the carriers of a.
+func AuthorizeWith(rba rbac.RBAC, a *auth.Authenticator, paths PathResolver) func(next http.Handler) http.Handler {
+	if paths == nil {
+		paths = func(r *http.Request) (map[string]string, string) {
+			return epm.GetRawPath(r)
+		}
+	}
+	resp := pagination.NewResponse(false)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, carrier, err := a.Authenticate(r)
+			if err != nil || data == nil {
+				resp.Error(r.Context(), w, nil, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			_, rawPath := paths(r)
+			principal := &Principal{
+				UserID:     data.UID,
+				AccountID:  data.AccountID,
+				Roles:      data.Roles,
+				ResourceID: rbac.URLToResourceID(rawPath),
+				Access:     rbac.HTTPMethodToAccessCode(r.Method),
+				Carrier:    carrier,
+				Cookie:     data,
+			}
+			if principal.Access == 0 {
+				resp.Error(r.Context(), w, errors.New("unsupported method "+r.Method), http.StatusForbidden, "forbidden")
+				return
+			}
+
+			hasAccess, err := rba.UserHasPermissionForResource(r.Context(), principal.UserID, principal.AccountID, &rbac.Resource{ID: principal.ResourceID}, principal.Access)
+			if err != nil && !errors.Is(err, rbac.ErrAccessDenied) {
+				resp.Error(r.Context(), w, err, http.StatusInternalServerError, "failed checking permissions")
+				return
+			}
+			if !hasAccess {
+				resp.Error(r.Context(), w, nil, http.StatusForbidden, "forbidden")
+				return
+			}
+			ctx := auth.WithData(r.Context(), data, carrier)
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(ctx, principal)))
+		})
+	}
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,145 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cookie "github.com/Seann-Moser/rutil/cook"
+	"github.com/Seann-Moser/rutil/epm"
+	"github.com/Seann-Moser/rutil/rbac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	backend := rbac.NewMemory()
+	role, _ := backend.NewRole(ctx, "reader", "", 1)
+	resource, err := backend.NewResource(ctx, "api.v1.items.{id}", "", "endpoint", "", true)
+	require.NoError(t, err)
+	require.NoError(t, backend.AddPermissionResourceToRole(ctx, role, resource, rbac.AccessRead))
+	require.NoError(t, backend.AddRoleToUser(ctx, role, "user-1", ""))
+
+	c := &cookie.Client{DefaultExpiresDuration: time.Hour, Salt: "test"}
+
+	var principal *Principal
+	router := epm.NewRouter(nil)
+	router.Use(Authorize(backend, c, router.GetRawPath))
+	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = GetPrincipal(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	e := &epm.Endpoint{Path: "/api/v1/items/{id}", Methods: []string{http.MethodGet, http.MethodPost}}
+	e.SetFunc(&f)
+	require.NoError(t, router.Handle(e))
+	assert.NotContains(t, epm.EndpointVarIDs, "id", "router path variables stay out of the global")
+
+	tests := []struct {
+		name   string
+		method string
+		uid    string
+		bearer bool
+		want   int
+	}{
+		{"no cookie", http.MethodGet, "", false, http.StatusUnauthorized},
+		{"read access", http.MethodGet, "user-1", false, http.StatusOK},
+		{"bearer read access", http.MethodGet, "user-1", true, http.StatusOK},
+		{"no write access", http.MethodPost, "user-1", false, http.StatusForbidden},
+		{"unknown user", http.MethodGet, "user-2", false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = nil
+			req := httptest.NewRequest(tt.method, "/api/v1/items/123", nil)
+			if tt.bearer {
+				token, err := c.JWT().Issue(&cookie.Data{UID: tt.uid, TokenID: "token"})
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer "+token)
+			} else if tt.uid != "" {
+				for _, ck := range c.GetCookies(req, &cookie.Data{UID: tt.uid, TokenID: "token"}) {
+					req.AddCookie(ck)
+				}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+			if tt.want == http.StatusOK {
+				require.NotNil(t, principal)
+				assert.Equal(t, tt.uid, principal.UserID)
+				assert.Equal(t, ".api.v1.items.{id}", principal.ResourceID)
+			}
+		})
+	}
+}
+
+type failingRBAC struct {
+	rbac.Mock
+}
+
+func (failingRBAC) UserHasPermissionForResource(ctx context.Context, userID, accountID string, resources *rbac.Resource, access ...int) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestAuthorizeBackendError(t *testing.T) {
+	c := &cookie.Client{DefaultExpiresDuration: time.Hour, Salt: "test"}
+	handler := Authorize(failingRBAC{}, c, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+	for _, ck := range c.GetCookies(req, &cookie.Data{UID: "user-1", TokenID: "token"}) {
+		req.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestAuthorizeWholeMux(t *testing.T) {
+	ctx := context.Background()
+	backend := rbac.NewMemory()
+	role, _ := backend.NewRole(ctx, "reader", "", 1)
+	for _, name := range []string{"api.v1.items.{id}", "api.v1.files.{path}"} {
+		resource, err := backend.NewResource(ctx, name, "", "endpoint", "", true)
+		require.NoError(t, err)
+		require.NoError(t, backend.AddPermissionResourceToRole(ctx, role, resource, rbac.AccessRead))
+	}
+	require.NoError(t, backend.AddRoleToUser(ctx, role, "user-1", ""))
+
+	c := &cookie.Client{DefaultExpiresDuration: time.Hour, Salt: "test"}
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("GET /api/v1/items/{id}", ok)
+	mux.Handle("GET /api/v1/files/{path...}", ok)
+
+	tests := []struct {
+		name  string
+		paths PathResolver
+		url   string
+		want  int
+	}{
+		{"raw url", nil, "/api/v1/items/123", http.StatusOK},
+		{"raw url denies remainder", nil, "/api/v1/files/a/b.txt", http.StatusForbidden},
+		{"raw url denies dotted value", nil, "/api/v1/items/v1.2", http.StatusForbidden},
+		{"mux pattern", MuxPaths(mux), "/api/v1/items/v1.2", http.StatusOK},
+		{"mux pattern with remainder", MuxPaths(mux), "/api/v1/files/a/b.txt", http.StatusOK},
+		{"mux without route", MuxPaths(mux), "/api/v1/users/123", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for _, ck := range c.GetCookies(req, &cookie.Data{UID: "user-1", TokenID: "token"}) {
+				req.AddCookie(ck)
+			}
+			w := httptest.NewRecorder()
+			Authorize(backend, c, tt.paths)(mux).ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -1,56 +1,92 @@
 package mid
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// CorsMiddleware implements CORS, see https://fetch.spec.whatwg.org/#http-cors-protocol.
+// Origins are matched exactly when given as scheme://host[:port], ie. https://app.example.com,
+// as subdomains when given as https://*.example.com or *.example.com, and as unanchored regular
+// expressions otherwise. "*" allows any origin. Empty or "*" methods and headers allow all.
 type CorsMiddleware struct {
 	AllowedOrigins     []*regexp.Regexp
 	AllowedMethods     []string
 	AllowedHeaders     []string
 	AllowedCredentials bool
+	// ExposedHeaders are response headers scripts of other origins can read.
+	ExposedHeaders []string
+	// MaxAge is how long browsers cache preflight responses, 0 leaves it to the browser.
+	MaxAge time.Duration
+	// AllowPrivateNetwork answers Private Network Access preflights of public sites to this
+	// server, see https://wicg.github.io/private-network-access/.
+	AllowPrivateNetwork bool
+
+	allowAll  bool
+	exact     map[string]bool
+	wildcards []originWildcard
+}
+
+type originWildcard struct {
+	// scheme is empty for patterns without a scheme
+	scheme string
+	suffix string
 }
 
 const (
-	corsAllowedOrigins     = "cors-allowed-origins"
-	corsAllowedMethods     = "cors-allowed-methods"
-	corsAllowedHeaders     = "cors-allowed-headers"
-	corsAllowedCredentials = "cors-allow-credentials"
+	corsAllowedOrigins      = "cors-allowed-origins"
+	corsAllowedMethods      = "cors-allowed-methods"
+	corsAllowedHeaders      = "cors-allowed-headers"
+	corsAllowedCredentials  = "cors-allow-credentials"
+	corsExposedHeaders      = "cors-exposed-headers"
+	corsMaxAge              = "cors-max-age"
+	corsAllowPrivateNetwork = "cors-allow-private-network"
 )
 
+var ErrCorsWildcardCredentials = errors.New("cors credentials can not be allowed with wildcards")
+
+var exactOrigin = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://[a-z0-9.-]+(:[0-9]+)?$|^null$`)
+
+// simpleMethods never need to be allowed explicitly.
+var simpleMethods = map[string]bool{http.MethodGet: true, http.MethodHead: true, http.MethodPost: true}
+
 func CorsFlags() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("cors", pflag.ExitOnError)
-	fs.StringSlice(corsAllowedOrigins, []string{}, "")
+	fs.StringSlice(corsAllowedOrigins, []string{}, "origins as https://app.example.com, https://*.example.com, * or unanchored regular expressions")
 	fs.StringSlice(corsAllowedMethods, []string{}, "")
 	fs.StringSlice(corsAllowedHeaders, []string{}, "")
 	fs.Bool(corsAllowedCredentials, false, "")
+	fs.StringSlice(corsExposedHeaders, []string{}, "response headers readable by other origins")
+	fs.Duration(corsMaxAge, 0, "how long browsers cache preflight responses")
+	fs.Bool(corsAllowPrivateNetwork, false, "allow private network access preflights")
 	return fs
 }
 
 func NewCorsFromFlags() (*CorsMiddleware, error) {
 	c := &CorsMiddleware{
-		AllowedOrigins:     []*regexp.Regexp{},
-		AllowedMethods:     viper.GetStringSlice(corsAllowedMethods),
-		AllowedHeaders:     viper.GetStringSlice(corsAllowedHeaders),
-		AllowedCredentials: viper.GetBool(corsAllowedCredentials),
-	}
-	for _, o := range viper.GetStringSlice(corsAllowedOrigins) {
-		exp, err := regexp.Compile(o)
-		if err != nil {
-			return nil, fmt.Errorf("failed compiling regex origin %s:%w", o, err)
-		}
-		c.AllowedOrigins = append(c.AllowedOrigins, exp)
+		AllowedOrigins:      []*regexp.Regexp{},
+		AllowedMethods:      viper.GetStringSlice(corsAllowedMethods),
+		AllowedHeaders:      viper.GetStringSlice(corsAllowedHeaders),
+		AllowedCredentials:  viper.GetBool(corsAllowedCredentials),
+		ExposedHeaders:      viper.GetStringSlice(corsExposedHeaders),
+		MaxAge:              viper.GetDuration(corsMaxAge),
+		AllowPrivateNetwork: viper.GetBool(corsAllowPrivateNetwork),
+	}
+	if err := c.addOrigins(viper.GetStringSlice(corsAllowedOrigins)); err != nil {
+		return nil, err
 	}
-	return c, nil
+	return c, c.Validate()
 }
 
+// NewCorsMiddleware allows any origin when origin is empty.
 func NewCorsMiddleware(origin []string, methods, headers []string, creds bool) (*CorsMiddleware, error) {
 	c := &CorsMiddleware{
 		AllowedOrigins:     []*regexp.Regexp{},
@@ -58,80 +94,183 @@ func NewCorsMiddleware(origin []string, methods, headers []string, creds bool) (
 		AllowedHeaders:     headers,
 		AllowedCredentials: creds,
 	}
-	for _, o := range origin {
-		exp, err := regexp.Compile(o)
-		if err != nil {
-			return nil, fmt.Errorf("failed compiling regex origin %s:%w", o, err)
+	if err := c.addOrigins(origin); err != nil {
+		return nil, err
+	}
+	if len(origin) == 0 {
+		c.allowAll = true
+	}
+	return c, c.Validate()
+}
+
+func (c *CorsMiddleware) addOrigins(patterns []string) error {
+	if c.exact == nil {
+		c.exact = map[string]bool{}
+	}
+	for _, o := range patterns {
+		o = strings.TrimSpace(o)
+		scheme, host, hasScheme := strings.Cut(o, "://")
+		if !hasScheme {
+			scheme, host = "", o
+		}
+		switch {
+		case o == "*" || o == ".*":
+			c.allowAll = true
+		case strings.HasPrefix(host, "*.") && exactOrigin.MatchString("x://"+strings.ToLower(host[2:])):
+			c.wildcards = append(c.wildcards, originWildcard{scheme: strings.ToLower(scheme), suffix: strings.ToLower(host[1:])})
+		case exactOrigin.MatchString(strings.ToLower(o)):
+			c.exact[strings.ToLower(o)] = true
+		default:
+			exp, err := regexp.Compile(o)
+			if err != nil {
+				return fmt.Errorf("failed compiling regex origin %s:%w", o, err)
+			}
+			c.AllowedOrigins = append(c.AllowedOrigins, exp)
 		}
-		c.AllowedOrigins = append(c.AllowedOrigins, exp)
 	}
-	if len(c.AllowedOrigins) == 0 {
-		exp, err := regexp.Compile(".*")
-		if err != nil {
-			return nil, fmt.Errorf("failed compiling regex origin %s:%w", ".*", err)
+	return nil
+}
+
+// Validate rejects credentials combined with wildcards, browsers refuse credentialed responses
+// with a wildcard and reflecting any origin instead would let every site read them.
+func (c *CorsMiddleware) Validate() error {
+	if !c.AllowedCredentials {
+		return nil
+	}
+	switch {
+	case c.allowAll:
+		return fmt.Errorf("%w: set --%s", ErrCorsWildcardCredentials, corsAllowedOrigins)
+	case isWildcard(c.AllowedMethods):
+		return fmt.Errorf("%w: set --%s", ErrCorsWildcardCredentials, corsAllowedMethods)
+	case isWildcard(c.AllowedHeaders):
+		return fmt.Errorf("%w: set --%s", ErrCorsWildcardCredentials, corsAllowedHeaders)
+	case contains(c.ExposedHeaders, "*"):
+		return fmt.Errorf("%w: --%s", ErrCorsWildcardCredentials, corsExposedHeaders)
+	}
+	return nil
+}
+
+func isWildcard(list []string) bool {
+	return len(list) == 0 || contains(list, "*")
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
 		}
-		c.AllowedOrigins = append(c.AllowedOrigins, exp)
 	}
-	return c, nil
+	return false
 }
 
 func (c *CorsMiddleware) Cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin, err := c.matchOrigin(r)
-		if err == nil {
-			c.setHeaders(w, origin)
-		}
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		origin := r.Header.Get("Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin)
 			return
 		}
-		// Next
+		if !c.allowAll || c.AllowedCredentials {
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin != "" && c.AllowsOrigin(origin) {
+			c.setOrigin(w, origin)
+			if len(c.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (c *CorsMiddleware) matchOrigin(r *http.Request) (string, error) {
-	origin := getOrigin(r)
-	for _, o := range c.AllowedOrigins {
-		if o.MatchString(origin) {
-			return origin, nil
-		}
+// preflight answers a preflight request with 204, or 403 without any cors headers when the
+// origin, method, headers or private network access are not allowed.
+func (c *CorsMiddleware) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network")
+	method := r.Header.Get("Access-Control-Request-Method")
+	headers := requestHeaders(r)
+	privateNetwork := r.Header.Get("Access-Control-Request-Private-Network") == "true"
+	if origin == "" || !c.AllowsOrigin(origin) || !c.allowsMethod(method) || !c.allowsHeaders(headers) ||
+		(privateNetwork && !c.AllowPrivateNetwork) {
+		w.WriteHeader(http.StatusForbidden)
+		return
 	}
-	return "", fmt.Errorf("invalid origin %s", origin)
-}
 
-func getOrigin(r *http.Request) string {
-	if v := r.Header.Get("Origin"); v != "" {
-		return v
+	c.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", method)
+	if len(headers) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
 	}
-	if v := r.Header.Get("Referer"); v != "" {
-		return v
+	if privateNetwork {
+		w.Header().Set("Access-Control-Allow-Private-Network", "true")
 	}
-	return ""
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (c *CorsMiddleware) setHeaders(w http.ResponseWriter, origin string) {
+func (c *CorsMiddleware) setOrigin(w http.ResponseWriter, origin string) {
+	if c.allowAll && !c.AllowedCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
 	w.Header().Set("Access-Control-Allow-Origin", origin)
-	w.Header().Set("Access-Control-Allow-Methods", c.getMethods())
-	w.Header().Set("Access-Control-Allow-Headers", c.getHeaders())
-	w.Header().Set("Access-Control-Allow-Credentials", strconv.FormatBool(c.AllowedCredentials))
+	if c.AllowedCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func requestHeaders(r *http.Request) []string {
+	var headers []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
 }
 
-func (c *CorsMiddleware) getMethods() string {
-	return getCorsData(c.AllowedMethods)
+func (c *CorsMiddleware) allowsMethod(method string) bool {
+	return simpleMethods[method] || (!c.AllowedCredentials && isWildcard(c.AllowedMethods)) || contains(c.AllowedMethods, method)
 }
 
-func (c *CorsMiddleware) getHeaders() string {
-	return getCorsData(c.AllowedHeaders)
+func (c *CorsMiddleware) allowsHeaders(headers []string) bool {
+	if !c.AllowedCredentials && isWildcard(c.AllowedHeaders) {
+		return true
+	}
+	for _, header := range headers {
+		if !contains(c.AllowedHeaders, header) {
+			return false
+		}
+	}
+	return true
 }
 
-func getCorsData(list []string) string {
-	if list == nil {
-		return "*"
+// AllowsOrigin reports whether origin matches the allowed origins, use it as cookie.CSRF.AllowedOrigin.
+func (c *CorsMiddleware) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if c.allowAll {
+		return true
 	}
-	if len(list) == 0 {
-		return "*"
+	lower := strings.ToLower(origin)
+	if c.exact[lower] {
+		return true
+	}
+	scheme, host, _ := strings.Cut(lower, "://")
+	for _, wildcard := range c.wildcards {
+		if (wildcard.scheme == "" || wildcard.scheme == scheme) && strings.HasSuffix(host, wildcard.suffix) && len(host) > len(wildcard.suffix) {
+			return true
+		}
+	}
+	for _, o := range c.AllowedOrigins {
+		if o.MatchString(origin) {
+			return true
+		}
 	}
-	return strings.Join(list, ", ")
+	return false
 }
@@ -0,0 +1,166 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowsOrigin(t *testing.T) {
+	c, err := NewCorsMiddleware([]string{`^https://app\.example\.com$`}, []string{"PUT"}, []string{"Content-Type"}, true)
+	require.NoError(t, err)
+	assert.True(t, c.AllowsOrigin("https://app.example.com"))
+	assert.False(t, c.AllowsOrigin("https://evil.example.org"))
+}
+
+func TestCorsOriginPatterns(t *testing.T) {
+	c, err := NewCorsMiddleware([]string{"https://app.example.com", "https://*.example.org", "*.example.net:8443", `internal\.test`}, nil, nil, false)
+	require.NoError(t, err)
+	tests := map[string]bool{
+		"https://app.example.com":            true,
+		"HTTPS://APP.EXAMPLE.COM":            true,
+		"http://app.example.com":             false,
+		"https://app.example.com.evil.org":   false,
+		"https://a.example.org":              true,
+		"https://a.b.example.org":            true,
+		"https://example.org":                false,
+		"http://a.example.org":               false,
+		"https://evilexample.org":            false,
+		"http://a.example.net:8443":          true,
+		"https://a.example.net":              false,
+		"https://www.internal.test.evil.org": true,
+		"null":                               false,
+		"":                                   false,
+	}
+	for origin, want := range tests {
+		assert.Equal(t, want, c.AllowsOrigin(origin), origin)
+	}
+}
+
+func TestCorsCredentialsWildcard(t *testing.T) {
+	for name, tt := range map[string]struct {
+		origins, methods, headers []string
+	}{
+		"origins":     {nil, []string{"PUT"}, []string{"X-Token"}},
+		"star origin": {[]string{"*"}, []string{"PUT"}, []string{"X-Token"}},
+		"methods":     {[]string{"https://app.example.com"}, nil, []string{"X-Token"}},
+		"headers":     {[]string{"https://app.example.com"}, []string{"PUT"}, []string{"*"}},
+	} {
+		_, err := NewCorsMiddleware(tt.origins, tt.methods, tt.headers, true)
+		assert.ErrorIs(t, err, ErrCorsWildcardCredentials, name)
+		_, err = NewCorsMiddleware(tt.origins, tt.methods, tt.headers, false)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	c, err := NewCorsMiddleware([]string{"https://app.example.com"}, []string{"PUT", "DELETE"}, []string{"Content-Type", "X-CSRF-Token"}, true)
+	require.NoError(t, err)
+	c.MaxAge = 10 * time.Minute
+	h := c.Cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name           string
+		origin         string
+		method         string
+		headers        string
+		privateNetwork bool
+		want           int
+	}{
+		{name: "allowed", origin: "https://app.example.com", method: "PUT", headers: "content-type, x-csrf-token", want: http.StatusNoContent},
+		{name: "simple method", origin: "https://app.example.com", method: "POST", want: http.StatusNoContent},
+		{name: "origin", origin: "https://evil.example.org", method: "PUT", want: http.StatusForbidden},
+		{name: "no origin", method: "PUT", want: http.StatusForbidden},
+		{name: "method", origin: "https://app.example.com", method: "PATCH", want: http.StatusForbidden},
+		{name: "header", origin: "https://app.example.com", method: "PUT", headers: "content-type, x-other", want: http.StatusForbidden},
+		{name: "private network", origin: "https://app.example.com", method: "PUT", privateNetwork: true, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, "/resource", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			if tt.privateNetwork {
+				r.Header.Set("Access-Control-Request-Private-Network", "true")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+			assert.Contains(t, w.Header().Get("Vary"), "Origin")
+			if tt.want != http.StatusNoContent {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				return
+			}
+			assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Equal(t, tt.method, w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+			if tt.headers != "" {
+				assert.Equal(t, tt.headers, w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+
+	c.AllowPrivateNetwork = true
+	r := httptest.NewRequest(http.MethodOptions, "/resource", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+	r.Header.Set("Access-Control-Request-Private-Network", "true")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Private-Network"))
+}
+
+func TestCorsActualRequest(t *testing.T) {
+	c, err := NewCorsMiddleware([]string{"https://*.example.com"}, []string{"PUT"}, []string{"Content-Type"}, true)
+	require.NoError(t, err)
+	c.ExposedHeaders = []string{"X-Request-Id"}
+	h := c.Cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	r := httptest.NewRequest(http.MethodPut, "/resource", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-Id", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	r = httptest.NewRequest(http.MethodGet, "/resource", nil)
+	r.Header.Set("Origin", "https://evil.example.org")
+	r.Header.Set("Referer", "https://app.example.com/page")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code, "the handler still runs, the browser hides the response")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	r = httptest.NewRequest(http.MethodOptions, "/resource", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code, "options requests without a preflight reach the handler")
+
+	public, err := NewCorsMiddleware(nil, nil, nil, false)
+	require.NoError(t, err)
+	r = httptest.NewRequest(http.MethodGet, "/resource", nil)
+	r.Header.Set("Origin", "https://any.example.org")
+	w = httptest.NewRecorder()
+	public.Cors(http.NotFoundHandler()).ServeHTTP(w, r)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Empty(t, w.Header().Get("Vary"))
+}
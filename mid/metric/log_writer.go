@@ -21,6 +21,8 @@ type AuditLog struct {
 	StatusCode int64  `json:"status_code" db:"status_code"`
 	LogType    string `json:"log_type" db:"log_type"`
 	Version    string `json:"version"`
+	Country    string `json:"country,omitempty" db:"country"`
+	ASN        uint   `json:"asn,omitempty" db:"asn"`
 }
 
 type contextKey struct {
@@ -3,6 +3,7 @@ package metric
 import (
 	"context"
 	"github.com/Seann-Moser/rutil/epm"
+	"github.com/Seann-Moser/rutil/pkg/device"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -48,6 +49,10 @@ func (m *Metrics) newAuditLog(r *http.Request) *AuditLog {
 		Method:  r.Method,
 		Version: m.Version,
 	}
+	if geo := device.GeoFromRequest(r); geo != nil {
+		entry.Country = geo.Country
+		entry.ASN = geo.ASN
+	}
 	return entry
 }
 
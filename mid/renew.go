@@ -0,0 +1,26 @@
+package mid
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Seann-Moser/cutil/logc"
+	cookie "github.com/Seann-Moser/rutil/cook"
+	"go.uber.org/zap"
+)
+
+// RenewCookie re-signs valid cookies with a new Expires once c.RenewAfter of their lifetime has
+// passed, so active users stay logged in until c.MaxSessionAge. Requests without a valid cookie
+// are passed through untouched, use Authorize to reject them.
+func RenewCookie(c *cookie.Client) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if data, valid := c.HasValidCookie(r); valid && c.NeedsRenewal(data, time.Now().UTC()) {
+				if err := c.Renew(w, r, data); err != nil {
+					logc.Warn(r.Context(), "failed renewing cookie", zap.String("uid", data.UID), zap.Error(err))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package mid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cookie "github.com/Seann-Moser/rutil/cook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewCookie(t *testing.T) {
+	c := &cookie.Client{DefaultExpiresDuration: 2 * time.Hour, Salt: "test", RenewAfter: 0.5}
+	handler := RenewCookie(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(issuer *cookie.Client) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, ck := range issuer.GetCookies(r, &cookie.Data{UID: "user-1", TokenID: "token"}) {
+			r.AddCookie(ck)
+		}
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request(c))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies(), "fresh cookies are not renewed")
+
+	// a cookie expiring in an hour was issued an hour ago for c, half of its lifetime
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request(&cookie.Client{DefaultExpiresDuration: time.Hour, Salt: "test"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	renewed := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, ck := range w.Result().Cookies() {
+		renewed.AddCookie(ck)
+	}
+	data, valid := c.HasValidCookie(renewed)
+	require.True(t, valid)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), data.Expires, time.Minute)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+}
@@ -2,63 +2,51 @@ package device
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
-	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// Device is a browser or app used by an account. ID has to identify it across logins, ie. the
+// unique id cookie of cookie.Client, a Registry refuses devices without one.
 type Device struct {
-	ID          string `db:"id" json:"id" qc:"primary;join,where::="`
-	IPv4        string `db:"ip_v4" json:"ip_v4" qc:"primary"`
-	IPv6        string `db:"ip_v6" json:"ip_v6" qc:"primary"`
-	UserAgent   string `db:"user_agent" json:"user_agent" qc:"data_type::text;primary"`
-	Active      bool   `db:"active" json:"active" qc:"default::true;update;where::="`
-	UpdatedDate string `db:"updated_date" json:"updated_date" qc:"skip;data_type::TIMESTAMP;default::NOW() ON UPDATE CURRENT_TIMESTAMP"`
-	CreatedDate string `db:"created_date" json:"created_date" qc:"skip;data_type::TIMESTAMP;default::NOW()"`
+	ID                string    `db:"id" json:"id" qc:"primary;varchar(512);join,where::="`
+	AccountID         string    `db:"account_id" json:"account_id" qc:"primary;varchar(512)"`
+	UID               string    `db:"uid" json:"uid" qc:"varchar(512);update"`
+	IPv4              string    `db:"ip_v4" json:"ip_v4" qc:"update"`
+	IPv6              string    `db:"ip_v6" json:"ip_v6" qc:"update"`
+	UserAgent         string    `db:"user_agent" json:"user_agent" qc:"data_type::text;update"`
+	Name              string    `db:"name" json:"name" qc:"update"`
+	Trusted           bool      `db:"trusted" json:"trusted" qc:"default::false;update"`
+	Active            bool      `db:"active" json:"active" qc:"default::true;update;where::="`
+	LastSeenTimestamp time.Time `db:"last_seen_timestamp" json:"last_seen_timestamp" qc:"update"`
+	UpdatedDate       string    `db:"updated_date" json:"updated_date" qc:"skip;data_type::TIMESTAMP;default::NOW() ON UPDATE CURRENT_TIMESTAMP"`
+	CreatedDate       string    `db:"created_date" json:"created_date" qc:"skip;data_type::TIMESTAMP;default::NOW()"`
+	// Hops is the forwarding chain of the request, see ClientIP.
+	Hops    []string `db:"-" json:"hops,omitempty"`
+	Profile *Profile `db:"-" json:"profile,omitempty"`
+	Geo     *Geo     `db:"-" json:"geo,omitempty"`
 }
 
+// GetDeviceFromRequest returns the device making r, resolving its ip with the resolver of the
+// request context or DefaultResolver.
 func GetDeviceFromRequest(r *http.Request) *Device {
-	device := &Device{}
-	device.loadIP(r)
-	device.UserAgent = r.UserAgent()
-	return device
+	return resolverFromContext(r.Context()).Device(r)
 }
 
-func (d *Device) loadIP(r *http.Request) {
-	IPAddress := r.Header.Get("X-Real-Ip")
-	if IPAddress == "" {
-		IPAddress = r.Header.Get("X-Forwarded-For")
-	}
-	if IPAddress == "" {
-		IPAddress = r.RemoteAddr
-	}
-
-	for _, ip := range strings.Split(IPAddress, ",") {
-		ip = strings.TrimSpace(ip)
-		if idx := strings.LastIndex(ip, ":"); idx != -1 && strings.Count(ip, ":") == 1 {
-			ip = ip[:idx]
-		}
-
-		parsedIP := net.ParseIP(ip)
-		if parsedIP == nil {
-			continue
-		}
-
-		if parsedIP.To4() != nil {
-			if d.IPv4 != "" {
-				d.IPv4 += "," + ip
-			} else {
-				d.IPv4 = ip
-			}
-		} else if parsedIP.To16() != nil {
-			if d.IPv6 != "" {
-				d.IPv6 += "," + ip
-			} else {
-				d.IPv6 = ip
-			}
-		}
+// Fingerprint identifies the kind of device by its browser, os, class and model without versions
+// or addresses, so it stays the same across updates and networks. It is shared by every device of
+// the same kind and must not be used as ID.
+func (d *Device) Fingerprint() string {
+	h := sha256.New()
+	if d.Profile != nil {
+		h.Write([]byte(strings.Join([]string{d.Profile.Browser, d.Profile.OS, string(d.Profile.Class), d.Profile.Model, d.Profile.BotName}, "|")))
+	} else {
+		h.Write([]byte(d.UserAgent))
 	}
+	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
 func (d *Device) GenerateDeviceKey(salt string) string {
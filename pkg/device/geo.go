@@ -0,0 +1,202 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"github.com/fsnotify/fsnotify"
+	"github.com/oschwald/maxminddb-golang"
+	"go.uber.org/zap"
+)
+
+// Geo is the location and network of an ip address.
+type Geo struct {
+	// Country is the ISO 3166-1 code, ie. US.
+	Country      string `json:"country,omitempty"`
+	Region       string `json:"region,omitempty"`
+	City         string `json:"city,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// GeoDB looks up ip addresses in local MaxMind format databases, ie. GeoLite2-City and
+// GeoLite2-ASN, without any network calls. The fields of all databases are merged, the first
+// database with a value wins.
+type GeoDB struct {
+	paths   []string
+	mu      sync.RWMutex
+	readers []*maxminddb.Reader
+}
+
+func OpenGeoDB(paths ...string) (*GeoDB, error) {
+	g := &GeoDB{paths: paths, readers: make([]*maxminddb.Reader, len(paths))}
+	for i := range paths {
+		if err := g.reload(i); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// reload reads the database i into memory, a database replaced on disk can not break lookups
+// this way. The previous database stays in use when the file is invalid.
+func (g *GeoDB) reload(i int) error {
+	data, err := os.ReadFile(g.paths[i])
+	if err != nil {
+		return fmt.Errorf("reading geo database %s: %w", g.paths[i], err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("opening geo database %s: %w", g.paths[i], err)
+	}
+	g.mu.Lock()
+	g.readers[i] = reader
+	g.mu.Unlock()
+	return nil
+}
+
+// Reload reads all databases again.
+func (g *GeoDB) Reload() error {
+	for i := range g.paths {
+		if err := g.reload(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch reloads databases when their files change until ctx is done.
+func (g *GeoDB) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// watch the directories, databases are usually replaced by renaming a new file over them
+	for _, path := range g.paths {
+		if err = watcher.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err = <-watcher.Errors:
+			logc.Error(ctx, "watching geo databases", zap.Error(err))
+		case event := <-watcher.Events:
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			for i, path := range g.paths {
+				if filepath.Clean(event.Name) != filepath.Clean(path) {
+					continue
+				}
+				if err = g.reload(i); err != nil {
+					logc.Warn(ctx, "failed reloading geo database", zap.Error(err))
+					continue
+				}
+				logc.Info(ctx, "reloaded geo database", zap.String("path", path))
+			}
+		}
+	}
+}
+
+// Lookup returns the location and network of ip, nil when no database knows it.
+func (g *GeoDB) Lookup(ip net.IP) (*Geo, error) {
+	if g == nil || ip == nil {
+		return nil, nil
+	}
+	g.mu.RLock()
+	readers := append([]*maxminddb.Reader{}, g.readers...)
+	g.mu.RUnlock()
+
+	geo := &Geo{}
+	found := false
+	for _, reader := range readers {
+		if reader.Metadata.IPVersion == 4 && ip.To4() == nil {
+			continue
+		}
+		var record geoRecord
+		_, ok, err := reader.LookupNetwork(ip, &record)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		if geo.Country == "" {
+			geo.Country = record.Country.ISOCode
+		}
+		if geo.Region == "" && len(record.Subdivisions) > 0 {
+			geo.Region = record.Subdivisions[0].Names["en"]
+		}
+		if geo.City == "" {
+			geo.City = record.City.Names["en"]
+		}
+		if geo.ASN == 0 {
+			geo.ASN = record.ASN
+		}
+		if geo.Organization == "" {
+			geo.Organization = record.Organization
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return geo, nil
+}
+
+// GeoFromRequest returns the location of the client ip of r, nil without a geo database.
+// Unlike GetDeviceFromRequest it does not parse the user agent, so it is cheap enough for
+// every request, ie. in audit logs.
+func GeoFromRequest(r *http.Request) *Geo {
+	res := resolverFromContext(r.Context())
+	if res.Geo == nil {
+		return nil
+	}
+	return res.lookupGeo(r, res.Resolve(r).IP)
+}
+
+func (res *Resolver) lookupGeo(r *http.Request, ip net.IP) *Geo {
+	geo, err := res.Geo.Lookup(ip)
+	if err != nil {
+		logc.Debug(r.Context(), "geo lookup failed", zap.Error(err))
+	}
+	return geo
+}
+
+// ASNKey returns a rate limit key grouping the requests of a network, ie. AS64496, or the
+// client ip when the network is unknown.
+func ASNKey(r *http.Request) string {
+	res := resolverFromContext(r.Context())
+	ip := res.Resolve(r).IP
+	if res.Geo != nil {
+		if geo := res.lookupGeo(r, ip); geo != nil && geo.ASN != 0 {
+			return fmt.Sprintf("AS%d", geo.ASN)
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,98 @@
+package device
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestGeoDB(t *testing.T) *GeoDB {
+	g, err := OpenGeoDB("testdata/geo-city-test.mmdb", "testdata/geo-asn-test.mmdb")
+	require.NoError(t, err)
+	return g
+}
+
+func TestGeoLookup(t *testing.T) {
+	g := openTestGeoDB(t)
+	tests := map[string]*Geo{
+		"192.0.2.55":     {Country: "US", Region: "California", City: "San Francisco", ASN: 64496, Organization: "Example Transit"},
+		"198.51.100.10":  {Country: "GB", Region: "England", City: "London", ASN: 64497, Organization: "Example Mobile"},
+		"198.51.100.200": {Country: "GB", Region: "England", City: "London"},
+		"2001:db8::1":    {Country: "DE", Region: "Berlin", City: "Berlin"},
+		"203.0.113.1":    nil,
+	}
+	for ip, want := range tests {
+		geo, err := g.Lookup(net.ParseIP(ip))
+		require.NoError(t, err)
+		assert.Equal(t, want, geo, ip)
+	}
+
+	_, err := OpenGeoDB("testdata/missing.mmdb")
+	assert.Error(t, err)
+}
+
+func TestGeoFromRequest(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+	res := &Resolver{TrustedProxies: proxies, Geo: openTestGeoDB(t)}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "192.0.2.55")
+	assert.Nil(t, GeoFromRequest(r), "no geo database in the default resolver")
+	assert.Equal(t, "10.0.0.1", ASNKey(r))
+
+	r = r.WithContext(WithResolver(r.Context(), res))
+	assert.Equal(t, "US", GeoFromRequest(r).Country)
+	assert.Equal(t, "AS64496", ASNKey(r))
+	assert.Equal(t, "San Francisco", GetDeviceFromRequest(r).Geo.City)
+
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+	assert.Equal(t, "203.0.113.1", ASNKey(r))
+	assert.Nil(t, GetDeviceFromRequest(r).Geo)
+}
+
+func TestGeoWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	require.NoError(t, os.WriteFile(path, testCityDB().bytes(), 0o644))
+	g, err := OpenGeoDB(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- g.Watch(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	lookup := func() string {
+		geo, err := g.Lookup(net.ParseIP("203.0.113.1"))
+		require.NoError(t, err)
+		if geo == nil {
+			return ""
+		}
+		return geo.Country
+	}
+	require.Equal(t, "", lookup())
+
+	// give the watcher time to start, then replace the database like a downloader would
+	time.Sleep(50 * time.Millisecond)
+	updated := filepath.Join(filepath.Dir(path), "city.mmdb.tmp")
+	require.NoError(t, os.WriteFile(updated, testCityDB().insert("203.0.113.0/24", cityRecord("FR", "Île-de-France", "Paris")).bytes(), 0o644))
+	require.NoError(t, os.Rename(updated, path))
+	assert.Eventually(t, func() bool { return lookup() == "FR" }, 2*time.Second, 10*time.Millisecond)
+
+	// a broken file keeps the last database
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "FR", lookup())
+}
@@ -0,0 +1,217 @@
+package device
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateFixtures = flag.Bool("update", false, "regenerate the geo test databases in testdata")
+
+// mmdbWriter writes minimal MaxMind DB files with an IPv6 search tree and 24 bit records, see
+// https://maxmind.github.io/MaxMind-DB/ for the format.
+type mmdbWriter struct {
+	databaseType string
+	networks     []mmdbNetwork
+}
+
+type mmdbNetwork struct {
+	network *net.IPNet
+	data    map[string]interface{}
+}
+
+type mmdbNode struct {
+	children [2]*mmdbNode
+	data     [2]int
+	id       int
+}
+
+func (w *mmdbWriter) insert(cidr string, data map[string]interface{}) *mmdbWriter {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	w.networks = append(w.networks, mmdbNetwork{network: network, data: data})
+	return w
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	var data bytes.Buffer
+	root := &mmdbNode{}
+	for _, n := range w.networks {
+		offset := data.Len()
+		encodeMMDB(&data, n.data)
+		ip := n.network.IP.To16()
+		ones, bits := n.network.Mask.Size()
+		if bits == 32 {
+			ones += 96
+			ip = append(make(net.IP, 12), n.network.IP.To4()...)
+		}
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if i == ones-1 {
+				node.data[bit] = offset + 1
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &mmdbNode{}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	var nodes []*mmdbNode
+	var number func(n *mmdbNode)
+	number = func(n *mmdbNode) {
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil {
+				number(child)
+			}
+		}
+	}
+	number(root)
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			record := len(nodes)
+			switch {
+			case n.children[bit] != nil:
+				record = n.children[bit].id
+			case n.data[bit] != 0:
+				record = len(nodes) + 16 + n.data[bit] - 1
+			}
+			out.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDB(&out, map[string]interface{}{
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               w.databaseType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"description":                 map[string]interface{}{"en": "rutil test database"},
+	})
+	return out.Bytes()
+}
+
+func mmdbControl(buf *bytes.Buffer, kind, size int) {
+	var extended []byte
+	if kind > 7 {
+		extended = []byte{byte(kind - 7)}
+		kind = 0
+	}
+	switch {
+	case size < 29:
+		buf.WriteByte(byte(kind<<5 | size))
+		buf.Write(extended)
+	case size < 285:
+		buf.WriteByte(byte(kind<<5 | 29))
+		buf.Write(extended)
+		buf.WriteByte(byte(size - 29))
+	default:
+		panic(fmt.Sprintf("mmdb test writer does not support size %d", size))
+	}
+}
+
+func encodeMMDB(buf *bytes.Buffer, value interface{}) {
+	uint := func(kind int, v uint64, size int) {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, v)
+		b = bytes.TrimLeft(b[8-size:], "\x00")
+		mmdbControl(buf, kind, len(b))
+		buf.Write(b)
+	}
+	switch v := value.(type) {
+	case string:
+		mmdbControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		uint(5, uint64(v), 2)
+	case uint32:
+		uint(6, uint64(v), 4)
+	case uint64:
+		uint(9, v, 8)
+	case float64:
+		mmdbControl(buf, 3, 8)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case []interface{}:
+		mmdbControl(buf, 11, len(v))
+		for _, item := range v {
+			encodeMMDB(buf, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		mmdbControl(buf, 7, len(keys))
+		for _, key := range keys {
+			encodeMMDB(buf, key)
+			encodeMMDB(buf, v[key])
+		}
+	default:
+		panic(fmt.Sprintf("mmdb test writer does not support %T", value))
+	}
+}
+
+func cityRecord(country, region, city string) map[string]interface{} {
+	return map[string]interface{}{
+		"country":      map[string]interface{}{"iso_code": country},
+		"subdivisions": []interface{}{map[string]interface{}{"names": map[string]interface{}{"en": region}}},
+		"city":         map[string]interface{}{"names": map[string]interface{}{"en": city}},
+	}
+}
+
+func asnRecord(asn uint32, organization string) map[string]interface{} {
+	return map[string]interface{}{
+		"autonomous_system_number":       asn,
+		"autonomous_system_organization": organization,
+	}
+}
+
+func testCityDB() *mmdbWriter {
+	return (&mmdbWriter{databaseType: "rutil-Test-City"}).
+		insert("192.0.2.0/24", cityRecord("US", "California", "San Francisco")).
+		insert("198.51.100.0/24", cityRecord("GB", "England", "London")).
+		insert("2001:db8::/32", cityRecord("DE", "Berlin", "Berlin"))
+}
+
+func testASNDB() *mmdbWriter {
+	return (&mmdbWriter{databaseType: "rutil-Test-ASN"}).
+		insert("192.0.2.0/24", asnRecord(64496, "Example Transit")).
+		insert("198.51.100.0/25", asnRecord(64497, "Example Mobile"))
+}
+
+// TestGeoFixtures keeps testdata in sync with the writer, run with -update to regenerate it.
+func TestGeoFixtures(t *testing.T) {
+	for path, db := range map[string]*mmdbWriter{
+		"testdata/geo-city-test.mmdb": testCityDB(),
+		"testdata/geo-asn-test.mmdb":  testASNDB(),
+	} {
+		if *updateFixtures {
+			require.NoError(t, os.WriteFile(path, db.bytes(), 0o644))
+		}
+		fixture, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, db.bytes(), fixture, "%s is outdated, run go test -run TestGeoFixtures -update", path)
+	}
+}
@@ -0,0 +1,277 @@
+package device
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Class is the kind of device making a request.
+type Class string
+
+const (
+	ClassDesktop Class = "desktop"
+	ClassMobile  Class = "mobile"
+	ClassTablet  Class = "tablet"
+	ClassBot     Class = "bot"
+)
+
+// AcceptCH lists the high entropy client hints Parser uses, send it in the Accept-CH response
+// header so browsers include them in later requests.
+const AcceptCH = "Sec-CH-UA-Full-Version-List, Sec-CH-UA-Platform-Version, Sec-CH-UA-Model"
+
+//go:embed ua_rules.yaml
+var defaultRules []byte
+
+// DefaultParser uses the rules embedded in the package.
+var DefaultParser = mustParser(defaultRules)
+
+// Profile is the parsed user agent of a device.
+type Profile struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Model          string `json:"model,omitempty"`
+	Class          Class  `json:"class,omitempty"`
+	Bot            bool   `json:"bot"`
+	// BotName is the crawler or http client, ie. Googlebot or curl.
+	BotName string `json:"bot_name,omitempty"`
+}
+
+// String describes the profile for people, ie. "Chrome on Windows".
+func (p *Profile) String() string {
+	name := p.Browser
+	if p.Bot {
+		name = p.BotName
+	}
+	if name == "" {
+		name = "Unknown browser"
+	}
+	if p.OS == "" {
+		return name
+	}
+	return name + " on " + p.OS
+}
+
+type rulesFile struct {
+	Bots     []ruleConfig      `yaml:"bots"`
+	Browsers []ruleConfig      `yaml:"browsers"`
+	OS       []ruleConfig      `yaml:"os"`
+	Devices  []ruleConfig      `yaml:"devices"`
+	Brands   map[string]string `yaml:"brands"`
+	Platform map[string]string `yaml:"platforms"`
+}
+
+type ruleConfig struct {
+	Name     string            `yaml:"name"`
+	Class    Class             `yaml:"class"`
+	Regex    string            `yaml:"regex"`
+	Versions map[string]string `yaml:"versions"`
+}
+
+type rule struct {
+	name     string
+	class    Class
+	regex    *regexp.Regexp
+	versions map[string]string
+}
+
+// Parser turns user agents and Sec-CH-UA client hints into profiles using a rules file, see
+// ua_rules.yaml for the format.
+type Parser struct {
+	bots      []rule
+	browsers  []rule
+	os        []rule
+	devices   []rule
+	brands    map[string]string
+	platforms map[string]string
+}
+
+func NewParser(rules []byte) (*Parser, error) {
+	var file rulesFile
+	if err := yaml.Unmarshal(rules, &file); err != nil {
+		return nil, fmt.Errorf("parsing user agent rules: %w", err)
+	}
+	p := &Parser{brands: file.Brands, platforms: file.Platform}
+	var err error
+	for _, section := range []struct {
+		name    string
+		configs []ruleConfig
+		rules   *[]rule
+	}{
+		{"bots", file.Bots, &p.bots},
+		{"browsers", file.Browsers, &p.browsers},
+		{"os", file.OS, &p.os},
+		{"devices", file.Devices, &p.devices},
+	} {
+		for i, config := range section.configs {
+			r := rule{name: config.Name, class: config.Class, versions: config.Versions}
+			if r.regex, err = regexp.Compile(config.Regex); err != nil {
+				return nil, fmt.Errorf("user agent rule %s[%d] %s: %w", section.name, i, config.Name, err)
+			}
+			*section.rules = append(*section.rules, r)
+		}
+	}
+	return p, nil
+}
+
+// LoadParser reads a rules file, use it to update the rules without a new release.
+func LoadParser(path string) (*Parser, error) {
+	rules, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewParser(rules)
+}
+
+func mustParser(rules []byte) *Parser {
+	p, err := NewParser(rules)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// match returns the first rule matching userAgent and the version it captured.
+func match(rules []rule, userAgent string) (*rule, string) {
+	for i := range rules {
+		groups := rules[i].regex.FindStringSubmatch(userAgent)
+		if groups == nil {
+			continue
+		}
+		var version string
+		for _, group := range groups[1:] {
+			if group != "" {
+				version = strings.ReplaceAll(group, "_", ".")
+				break
+			}
+		}
+		if mapped, found := rules[i].versions[version]; found {
+			version = mapped
+		}
+		return &rules[i], version
+	}
+	return nil, ""
+}
+
+// FromRequest parses the User-Agent and client hint headers of r.
+func (p *Parser) FromRequest(r *http.Request) *Profile {
+	return p.Parse(r.UserAgent(), r.Header)
+}
+
+// Parse parses userAgent, client hints in headers take precedence as browsers freeze parts of
+// the user agent, ie. Windows 11 still reports Windows NT 10.0. headers can be nil.
+func (p *Parser) Parse(userAgent string, headers http.Header) *Profile {
+	profile := &Profile{}
+	if bot, _ := match(p.bots, userAgent); bot != nil {
+		profile.Bot = true
+		profile.BotName = bot.name
+		profile.Class = ClassBot
+	}
+	if browser, version := match(p.browsers, userAgent); browser != nil {
+		profile.Browser = browser.name
+		profile.BrowserVersion = version
+	}
+	if system, version := match(p.os, userAgent); system != nil {
+		profile.OS = system.name
+		profile.OSVersion = version
+	}
+	if !profile.Bot && userAgent != "" {
+		profile.Class = ClassDesktop
+		if device, _ := match(p.devices, userAgent); device != nil {
+			profile.Class = device.class
+		}
+	}
+	if headers != nil {
+		p.applyClientHints(profile, headers)
+	}
+	return profile
+}
+
+func (p *Parser) applyClientHints(profile *Profile, headers http.Header) {
+	if brand, version := p.brand(headers.Get("Sec-CH-UA-Full-Version-List")); brand != "" {
+		profile.Browser, profile.BrowserVersion = brand, version
+	} else if brand, version = p.brand(headers.Get("Sec-CH-UA")); brand != "" {
+		profile.Browser = brand
+		if !strings.HasPrefix(profile.BrowserVersion, version+".") {
+			profile.BrowserVersion = version
+		}
+	}
+	if platform := unquote(headers.Get("Sec-CH-UA-Platform")); platform != "" && !strings.EqualFold(platform, "Unknown") {
+		if mapped, found := p.platforms[platform]; found {
+			platform = mapped
+		}
+		if platform != profile.OS {
+			profile.OSVersion = ""
+		}
+		profile.OS = platform
+		if version := platformVersion(platform, unquote(headers.Get("Sec-CH-UA-Platform-Version"))); version != "" {
+			profile.OSVersion = version
+		}
+	}
+	if model := unquote(headers.Get("Sec-CH-UA-Model")); model != "" {
+		profile.Model = model
+	}
+	if headers.Get("Sec-CH-UA-Mobile") == "?1" && !profile.Bot {
+		profile.Class = ClassMobile
+	}
+}
+
+// brand picks the browser of a Sec-CH-UA brand list, skipping GREASE brands like
+// "Not-A.Brand" and preferring a specific brand over Chromium.
+func (p *Parser) brand(list string) (string, string) {
+	var name, version string
+	for _, entry := range strings.Split(list, ",") {
+		brand, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		brand = unquote(brand)
+		lower := strings.ToLower(brand)
+		if brand == "" || (strings.Contains(lower, "not") && strings.Contains(lower, "brand")) {
+			continue
+		}
+		if name != "" && brand == "Chromium" {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if key != "v" {
+			value = ""
+		}
+		mapped, found := p.brands[brand]
+		if !found {
+			mapped = brand
+		}
+		name, version = mapped, unquote(value)
+		if brand != "Chromium" {
+			break
+		}
+	}
+	return name, version
+}
+
+// platformVersion maps the Sec-CH-UA-Platform-Version of Windows to its marketing version,
+// versions before Windows 10 are all reported as 0 and return nothing.
+func platformVersion(platform, version string) string {
+	if platform != "Windows" {
+		return version
+	}
+	major, _, _ := strings.Cut(version, ".")
+	switch n, err := strconv.Atoi(major); {
+	case err != nil:
+		return version
+	case n >= 13:
+		return "11"
+	case n > 0:
+		return "10"
+	}
+	return ""
+}
+
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"`)
+}
@@ -0,0 +1,125 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      Profile
+		describe  string
+	}{
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want:      Profile{Browser: "Chrome", BrowserVersion: "124.0.0.0", OS: "Windows", OSVersion: "10", Class: ClassDesktop},
+			describe:  "Chrome on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			want:      Profile{Browser: "Edge", BrowserVersion: "124.0.2478.51", OS: "Windows", OSVersion: "10", Class: ClassDesktop},
+			describe:  "Edge on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1",
+			want:      Profile{Browser: "Safari", BrowserVersion: "17.4.1", OS: "iOS", OSVersion: "17.4.1", Class: ClassMobile},
+			describe:  "Safari on iOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			want:      Profile{Browser: "Chrome", BrowserVersion: "120.0.6099.119", OS: "iOS", OSVersion: "16.6", Class: ClassTablet},
+			describe:  "Chrome on iOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want:      Profile{Browser: "Chrome", BrowserVersion: "124.0.0.0", OS: "Android", OSVersion: "14", Class: ClassMobile},
+			describe:  "Chrome on Android",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Safari/537.36",
+			want:      Profile{Browser: "Samsung Internet", BrowserVersion: "24.0", OS: "Android", OSVersion: "13", Class: ClassTablet},
+			describe:  "Samsung Internet on Android",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want:      Profile{Browser: "Firefox", BrowserVersion: "125.0", OS: "macOS", OSVersion: "10.15", Class: ClassDesktop},
+			describe:  "Firefox on macOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want:      Profile{Browser: "Firefox", BrowserVersion: "125.0", OS: "Linux", Class: ClassDesktop},
+			describe:  "Firefox on Linux",
+		},
+		{
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want:      Profile{Bot: true, BotName: "Googlebot", Class: ClassBot},
+			describe:  "Googlebot",
+		},
+		{
+			userAgent: "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/116.0.1938.76 Safari/537.36",
+			want:      Profile{Browser: "Chrome", BrowserVersion: "116.0.1938.76", Bot: true, BotName: "Bingbot", Class: ClassBot},
+			describe:  "Bingbot",
+		},
+		{
+			userAgent: "curl/8.4.0",
+			want:      Profile{Bot: true, BotName: "curl", Class: ClassBot},
+			describe:  "curl",
+		},
+		{
+			userAgent: "",
+			want:      Profile{},
+			describe:  "Unknown browser",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.describe, func(t *testing.T) {
+			profile := DefaultParser.Parse(tt.userAgent, nil)
+			assert.Equal(t, tt.want, *profile)
+			assert.Equal(t, tt.describe, profile.String())
+		})
+	}
+}
+
+func TestParseClientHints(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36")
+	r.Header.Set("Sec-CH-UA", `"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`)
+	r.Header.Set("Sec-CH-UA-Full-Version-List", `"Chromium";v="124.0.6367.91", "Microsoft Edge";v="124.0.2478.67", "Not-A.Brand";v="99.0.0.0"`)
+	r.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
+	r.Header.Set("Sec-CH-UA-Platform-Version", `"15.0.0"`)
+	r.Header.Set("Sec-CH-UA-Mobile", "?0")
+
+	profile := GetDeviceFromRequest(r).Profile
+	assert.Equal(t, Profile{Browser: "Edge", BrowserVersion: "124.0.2478.67", OS: "Windows", OSVersion: "11", Class: ClassDesktop}, *profile)
+
+	r.Header.Del("Sec-CH-UA-Full-Version-List")
+	r.Header.Set("Sec-CH-UA", `"Google Chrome";v="124", "Chromium";v="124", "Not-A.Brand";v="99"`)
+	r.Header.Set("Sec-CH-UA-Platform", `"Android"`)
+	r.Header.Set("Sec-CH-UA-Platform-Version", `"14.0.0"`)
+	r.Header.Set("Sec-CH-UA-Mobile", "?1")
+	r.Header.Set("Sec-CH-UA-Model", `"Pixel 8"`)
+	profile = DefaultParser.FromRequest(r)
+	assert.Equal(t, Profile{Browser: "Chrome", BrowserVersion: "124.0.0.0", OS: "Android", OSVersion: "14.0.0", Model: "Pixel 8", Class: ClassMobile}, *profile)
+	assert.Equal(t, "Chrome on Android", profile.String())
+}
+
+func TestNewParser(t *testing.T) {
+	p, err := NewParser([]byte(`
+browsers:
+  - name: Internal
+    regex: 'InternalApp/(\d+)'
+devices:
+  - class: mobile
+    regex: 'InternalApp'
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Browser: "Internal", BrowserVersion: "3", Class: ClassMobile}, *p.Parse("InternalApp/3", nil))
+
+	_, err = NewParser([]byte("bots:\n  - name: broken\n    regex: '('\n"))
+	assert.Error(t, err)
+}
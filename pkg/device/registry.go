@@ -0,0 +1,181 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrNoDeviceID is returned for devices without a caller supplied ID. Fingerprints are shared
+	// by every device of the same kind, so they cannot tell a known device from another one.
+	ErrNoDeviceID = errors.New("missing device id")
+)
+
+// Registry remembers the devices accounts logged in from, so auth flows can require step up
+// authentication or send alerts for unfamiliar devices. Devices are keyed by AccountID and ID,
+// Register, IsNew and Trust return ErrNoDeviceID when the ID is empty.
+type Registry interface {
+	// Register records d on login and reports whether the account has not used it before.
+	// Deactivated devices are new again and lose their trust.
+	Register(ctx context.Context, d *Device) (bool, error)
+	// IsNew reports whether d is unknown or deactivated for its account without recording it.
+	IsNew(ctx context.Context, d *Device) (bool, error)
+	// Get returns ErrDeviceNotFound for unknown devices.
+	Get(ctx context.Context, accountID, id string) (*Device, error)
+	// List returns the active devices of the account, most recently seen first.
+	List(ctx context.Context, accountID string) ([]*Device, error)
+	// Trust marks a device as trusted or untrusted, ie. after step up authentication.
+	Trust(ctx context.Context, accountID, id string, trusted bool) error
+	Deactivate(ctx context.Context, accountID, id string) error
+}
+
+// RegisterRequest registers the device making r for the account and returns it. id is the
+// stable device id of the caller, ie. cookie.Client.GetUniqueID, it is required.
+func RegisterRequest(r *http.Request, registry Registry, accountID, uid, id string) (*Device, bool, error) {
+	d := GetDeviceFromRequest(r)
+	d.AccountID = accountID
+	d.UID = uid
+	d.ID = id
+	isNew, err := registry.Register(r.Context(), d)
+	return d, isNew, err
+}
+
+func deviceID(d *Device) (string, error) {
+	if d == nil || d.AccountID == "" {
+		return "", fmt.Errorf("invalid device, missing account id")
+	}
+	if d.ID == "" {
+		return "", ErrNoDeviceID
+	}
+	return d.ID, nil
+}
+
+// merge updates d with the record of the registry and reports whether it is new.
+func merge(known, d *Device, now time.Time) bool {
+	d.LastSeenTimestamp = now
+	d.Active = true
+	if d.Name == "" && d.Profile != nil {
+		d.Name = d.Profile.String()
+	}
+	if known == nil || !known.Active {
+		d.Trusted = false
+		return true
+	}
+	d.Trusted = known.Trusted
+	d.CreatedDate = known.CreatedDate
+	return false
+}
+
+var _ Registry = &MemoryRegistry{}
+
+// MemoryRegistry keeps devices in memory, for tests and single instance deployments.
+type MemoryRegistry struct {
+	mu      sync.RWMutex
+	devices map[string]*Device
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{devices: map[string]*Device{}}
+}
+
+func registryKey(accountID, id string) string {
+	return accountID + "/" + id
+}
+
+func (m *MemoryRegistry) Register(ctx context.Context, d *Device) (bool, error) {
+	id, err := deviceID(d)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	isNew := merge(m.devices[registryKey(d.AccountID, id)], d, now)
+	if d.CreatedDate == "" {
+		d.CreatedDate = now.Format(time.RFC3339)
+	}
+	d.UpdatedDate = now.Format(time.RFC3339)
+	stored := *d
+	m.devices[registryKey(d.AccountID, id)] = &stored
+	return isNew, nil
+}
+
+func (m *MemoryRegistry) IsNew(ctx context.Context, d *Device) (bool, error) {
+	id, err := deviceID(d)
+	if err != nil {
+		return false, err
+	}
+	known, err := m.Get(ctx, d.AccountID, id)
+	if errors.Is(err, ErrDeviceNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !known.Active, nil
+}
+
+func (m *MemoryRegistry) Get(ctx context.Context, accountID, id string) (*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	d, found := m.devices[registryKey(accountID, id)]
+	if !found {
+		return nil, ErrDeviceNotFound
+	}
+	device := *d
+	return &device, nil
+}
+
+func (m *MemoryRegistry) List(ctx context.Context, accountID string) ([]*Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	devices := []*Device{}
+	for _, d := range m.devices {
+		if d.AccountID == accountID && d.Active {
+			device := *d
+			devices = append(devices, &device)
+		}
+	}
+	sortDevices(devices)
+	return devices, nil
+}
+
+func (m *MemoryRegistry) Trust(ctx context.Context, accountID, id string, trusted bool) error {
+	if id == "" {
+		return ErrNoDeviceID
+	}
+	return m.update(accountID, id, func(d *Device) {
+		d.Trusted = trusted
+	})
+}
+
+func (m *MemoryRegistry) Deactivate(ctx context.Context, accountID, id string) error {
+	return m.update(accountID, id, func(d *Device) {
+		d.Active = false
+		d.Trusted = false
+	})
+}
+
+func (m *MemoryRegistry) update(accountID, id string, fn func(d *Device)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, found := m.devices[registryKey(accountID, id)]
+	if !found {
+		return ErrDeviceNotFound
+	}
+	fn(d)
+	d.UpdatedDate = time.Now().UTC().Format(time.RFC3339)
+	return nil
+}
+
+func sortDevices(devices []*Device) {
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeenTimestamp.After(devices[j].LastSeenTimestamp)
+	})
+}
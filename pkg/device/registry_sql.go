@@ -0,0 +1,130 @@
+package device
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Seann-Moser/cutil/sqlc"
+	"github.com/Seann-Moser/cutil/sqlc/orm"
+)
+
+const deviceDatabase = "devices"
+
+var _ Registry = &SQLRegistry{}
+
+// SQLRegistry keeps devices in the device table, call InitTables before using it.
+type SQLRegistry struct{}
+
+func NewSQLRegistry() *SQLRegistry {
+	return &SQLRegistry{}
+}
+
+func (s *SQLRegistry) InitTables(ctx context.Context, dao *sqlc.DAO) (context.Context, error) {
+	return sqlc.AddTable[Device](ctx, dao, deviceDatabase, orm.QueryTypeSQL)
+}
+
+func (s *SQLRegistry) table(ctx context.Context) (*orm.Table[Device], error) {
+	return sqlc.GetTableCtx[Device](ctx)
+}
+
+func (s *SQLRegistry) Register(ctx context.Context, d *Device) (bool, error) {
+	id, err := deviceID(d)
+	if err != nil {
+		return false, err
+	}
+	known, err := s.Get(ctx, d.AccountID, id)
+	if err != nil && !errors.Is(err, ErrDeviceNotFound) {
+		return false, err
+	}
+	isNew := merge(known, d, time.Now().UTC())
+	table, err := s.table(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, err = table.Upsert(ctx, nil, *d)
+	return isNew, err
+}
+
+func (s *SQLRegistry) IsNew(ctx context.Context, d *Device) (bool, error) {
+	id, err := deviceID(d)
+	if err != nil {
+		return false, err
+	}
+	known, err := s.Get(ctx, d.AccountID, id)
+	if errors.Is(err, ErrDeviceNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !known.Active, nil
+}
+
+func (s *SQLRegistry) Get(ctx context.Context, accountID, id string) (*Device, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := orm.QueryTable[Device](table).
+		Where(table.GetColumn("account_id"), "=", "AND", 0, accountID).
+		Where(table.GetColumn("id"), "=", "AND", 0, id).
+		Run(ctx, nil)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && len(rows) == 0) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+func (s *SQLRegistry) List(ctx context.Context, accountID string) ([]*Device, error) {
+	table, err := s.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := orm.QueryTable[Device](table).
+		Where(table.GetColumn("account_id"), "=", "AND", 0, accountID).
+		Where(table.GetColumn("active"), "=", "AND", 0, true).
+		Run(ctx, nil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []*Device{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortDevices(rows)
+	return rows, nil
+}
+
+func (s *SQLRegistry) Trust(ctx context.Context, accountID, id string, trusted bool) error {
+	if id == "" {
+		return ErrNoDeviceID
+	}
+	return s.update(ctx, accountID, id, func(d *Device) {
+		d.Trusted = trusted
+	})
+}
+
+func (s *SQLRegistry) Deactivate(ctx context.Context, accountID, id string) error {
+	return s.update(ctx, accountID, id, func(d *Device) {
+		d.Active = false
+		d.Trusted = false
+	})
+}
+
+func (s *SQLRegistry) update(ctx context.Context, accountID, id string, fn func(d *Device)) error {
+	d, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return err
+	}
+	fn(d)
+	table, err := s.table(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = table.Upsert(ctx, nil, *d)
+	return err
+}
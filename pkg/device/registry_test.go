@@ -0,0 +1,76 @@
+package device
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+
+	login := func(ip, userAgent, id string) (*Device, bool) {
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("User-Agent", userAgent)
+		d, isNew, err := RegisterRequest(r, registry, "acc-1", "user-1", id)
+		require.NoError(t, err)
+		return d, isNew
+	}
+	const chromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	const chromeWindowsUpdated = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36"
+	const firefoxMac = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:125.0) Gecko/20100101 Firefox/125.0"
+
+	laptop, isNew := login("192.0.2.1", chromeWindows, "laptop")
+	assert.True(t, isNew)
+	assert.Equal(t, "Chrome on Windows", laptop.Name)
+	assert.False(t, laptop.Trusted)
+	require.NoError(t, registry.Trust(ctx, "acc-1", laptop.ID, true))
+
+	again, isNew := login("198.51.100.7", chromeWindowsUpdated, "laptop")
+	assert.False(t, isNew, "browser updates and new networks are the same device")
+	assert.Equal(t, laptop.ID, again.ID)
+	assert.True(t, again.Trusted)
+
+	other, isNew := login("203.0.113.5", chromeWindows, "attacker")
+	assert.True(t, isNew, "devices of the same kind are told apart by their id")
+	assert.False(t, other.Trusted)
+	require.NoError(t, registry.Deactivate(ctx, "acc-1", other.ID))
+
+	phone, isNew := login("192.0.2.1", firefoxMac, "unique-id")
+	assert.True(t, isNew)
+	assert.Equal(t, "unique-id", phone.ID)
+
+	newDevice, err := registry.IsNew(ctx, &Device{AccountID: "acc-2", ID: "unique-id"})
+	require.NoError(t, err)
+	assert.True(t, newDevice, "devices are per account")
+
+	devices, err := registry.List(ctx, "acc-1")
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	assert.Equal(t, "unique-id", devices[0].ID, "most recently seen first")
+	assert.Equal(t, "198.51.100.7", devices[1].IPv4)
+
+	require.NoError(t, registry.Deactivate(ctx, "acc-1", laptop.ID))
+	devices, err = registry.List(ctx, "acc-1")
+	require.NoError(t, err)
+	assert.Len(t, devices, 1)
+
+	again, isNew = login("192.0.2.1", chromeWindows, "laptop")
+	assert.True(t, isNew, "deactivated devices are new again")
+	assert.False(t, again.Trusted)
+
+	assert.ErrorIs(t, registry.Deactivate(ctx, "acc-1", "missing"), ErrDeviceNotFound)
+	_, err = registry.Register(ctx, &Device{ID: "no-account"})
+	assert.Error(t, err)
+	_, err = registry.Register(ctx, &Device{AccountID: "acc-1", UserAgent: chromeWindows})
+	assert.ErrorIs(t, err, ErrNoDeviceID, "fingerprints are not device ids")
+	_, err = registry.IsNew(ctx, &Device{AccountID: "acc-1", UserAgent: chromeWindows})
+	assert.ErrorIs(t, err, ErrNoDeviceID)
+	assert.ErrorIs(t, registry.Trust(ctx, "acc-1", "", true), ErrNoDeviceID)
+}
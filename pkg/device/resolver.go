@@ -0,0 +1,260 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	trustedProxiesFlag  = "device-trusted-proxies"
+	userAgentRulesFlag  = "device-user-agent-rules"
+	geoDatabasesFlag    = "device-geo-databases"
+	forwardedHeaderFlag = "device-forwarded-header"
+)
+
+// Forwarding headers a Resolver can read the client ip from.
+const (
+	HeaderForwarded    = "Forwarded"
+	HeaderForwardedFor = "X-Forwarded-For"
+	HeaderRealIP       = "X-Real-Ip"
+)
+
+// DefaultResolver is used by GetDeviceFromRequest for requests without a resolver in their
+// context. It trusts no proxies, so forwarding headers are ignored until it is configured.
+var DefaultResolver = &Resolver{}
+
+// Resolver determines the client ip of requests. Forwarding headers are only believed when they
+// were added by one of the TrustedProxies, anyone else could put any address into them.
+type Resolver struct {
+	TrustedProxies []*net.IPNet
+	// Header is the single forwarding header the TrustedProxies write, HeaderForwardedFor when
+	// empty. The other forwarding headers are ignored, a client could send them to get its own
+	// chain read instead of the one appended by the proxies.
+	Header string
+	// Parser builds the Profile of devices, DefaultParser is used when nil.
+	Parser *Parser
+	// Geo adds the location of the client ip to devices when set.
+	Geo *GeoDB
+}
+
+// ClientIP is the resolved address of a request.
+type ClientIP struct {
+	// IP is the canonical client ip, IPv4 addresses are always 4 bytes long.
+	IP net.IP
+	// Hops is the forwarding chain starting with the client as reported by the forwarding
+	// headers and ending with the remote address of the connection. Hops left of IP were
+	// reported by the client itself and are not verified.
+	Hops []net.IP
+}
+
+func Flags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("device", pflag.ExitOnError)
+	fs.StringSlice(trustedProxiesFlag, nil, "ips or cidrs of proxies whose forwarding header is trusted")
+	fs.String(forwardedHeaderFlag, HeaderForwardedFor, "forwarding header written by the trusted proxies: Forwarded, X-Forwarded-For or X-Real-Ip")
+	fs.String(userAgentRulesFlag, "", "user agent rules file replacing the embedded rules")
+	fs.StringSlice(geoDatabasesFlag, nil, "MaxMind format .mmdb city and asn databases to look up client ips in")
+	return fs
+}
+
+func NewResolverFromFlags() (*Resolver, error) {
+	proxies, err := ParseTrustedProxies(viper.GetStringSlice(trustedProxiesFlag)...)
+	if err != nil {
+		return nil, err
+	}
+	res := &Resolver{TrustedProxies: proxies, Header: http.CanonicalHeaderKey(viper.GetString(forwardedHeaderFlag))}
+	switch res.Header {
+	case "", HeaderForwarded, HeaderForwardedFor, HeaderRealIP:
+	default:
+		return nil, fmt.Errorf("unsupported forwarding header %q", res.Header)
+	}
+	if path := viper.GetString(userAgentRulesFlag); path != "" {
+		if res.Parser, err = LoadParser(path); err != nil {
+			return nil, err
+		}
+	}
+	if paths := viper.GetStringSlice(geoDatabasesFlag); len(paths) > 0 {
+		if res.Geo, err = OpenGeoDB(paths...); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// ParseTrustedProxies parses ips and cidrs, ie. 10.0.0.0/8 or 192.0.2.1, into networks.
+func ParseTrustedProxies(proxies ...string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := len(ip) * 8
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+type resolverKey struct{}
+
+// WithResolver makes GetDeviceFromRequest use res for requests with the returned context.
+func WithResolver(ctx context.Context, res *Resolver) context.Context {
+	return context.WithValue(ctx, resolverKey{}, res)
+}
+
+func resolverFromContext(ctx context.Context) *Resolver {
+	if res, ok := ctx.Value(resolverKey{}).(*Resolver); ok && res != nil {
+		return res
+	}
+	return DefaultResolver
+}
+
+// Trusted reports whether ip belongs to one of the TrustedProxies.
+func (res *Resolver) Trusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range res.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve walks the forwarding chain of r from the connection towards the client and returns
+// the first address that is not a trusted proxy. The chain is read from the configured Header
+// only. An obfuscated or unparsable hop ends the walk at the last known address since nothing
+// left of it can be attributed.
+func (res *Resolver) Resolve(r *http.Request) *ClientIP {
+	hops := append(res.forwardedHops(r), ParseIP(r.RemoteAddr))
+	i := len(hops) - 1
+	for i > 0 && res.Trusted(hops[i]) {
+		i--
+	}
+	if hops[i] == nil && i < len(hops)-1 {
+		i++
+	}
+	client := &ClientIP{IP: hops[i]}
+	for _, hop := range hops {
+		if hop != nil {
+			client.Hops = append(client.Hops, hop)
+		}
+	}
+	return client
+}
+
+// Device returns the device making r with the resolved client ip and parsed user agent.
+func (res *Resolver) Device(r *http.Request) *Device {
+	parser := res.Parser
+	if parser == nil {
+		parser = DefaultParser
+	}
+	d := &Device{UserAgent: r.UserAgent(), Profile: parser.FromRequest(r)}
+	client := res.Resolve(r)
+	if client.IP != nil {
+		if len(client.IP) == net.IPv4len {
+			d.IPv4 = client.IP.String()
+		} else {
+			d.IPv6 = client.IP.String()
+		}
+	}
+	for _, hop := range client.Hops {
+		d.Hops = append(d.Hops, hop.String())
+	}
+	if res.Geo != nil {
+		d.Geo = res.lookupGeo(r, client.IP)
+	}
+	return d
+}
+
+// forwardedHops returns the addresses of the forwarding header of r, client first. Unknown
+// hops are nil.
+func (res *Resolver) forwardedHops(r *http.Request) []net.IP {
+	header := http.CanonicalHeaderKey(res.Header)
+	if header == "" {
+		header = HeaderForwardedFor
+	}
+	values := r.Header.Values(header)
+	if len(values) == 0 {
+		return nil
+	}
+	var hops []net.IP
+	switch header {
+	case HeaderForwarded:
+		for _, element := range splitQuoted(strings.Join(values, ","), ',') {
+			var hop net.IP
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hop = ParseIP(value)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	case HeaderForwardedFor:
+		for _, value := range strings.Split(strings.Join(values, ","), ",") {
+			hops = append(hops, ParseIP(value))
+		}
+	case HeaderRealIP:
+		hops = append(hops, ParseIP(values[0]))
+	}
+	return hops
+}
+
+// splitQuoted splits s at sep outside of double quoted strings.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ParseIP parses an address as found in RemoteAddr and forwarding headers: optionally quoted,
+// with a port, IPv6 in brackets and with a zone, ie. "[fe80::1%eth0]:443" or 192.0.2.1:8080.
+// IPv4 and IPv4 mapped IPv6 addresses are returned with 4 bytes. Obfuscated RFC 7239
+// identifiers like unknown or _hidden return nil.
+func ParseIP(value string) net.IP {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.Trim(value, "[]")
+	if i := strings.IndexByte(value, '%'); i != -1 {
+		value = value[:i]
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
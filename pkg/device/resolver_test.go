@@ -0,0 +1,134 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8", "2001:db8:ffff::/48", "192.0.2.1")
+	require.NoError(t, err)
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+		hops       []string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "203.0.113.7:4000",
+			want:       "203.0.113.7",
+			hops:       []string{"203.0.113.7"},
+		},
+		{
+			name:       "spoofed headers from untrusted client",
+			remoteAddr: "203.0.113.7:4000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-Ip": "8.8.8.8"},
+			want:       "203.0.113.7",
+			hops:       []string{"1.1.1.1", "203.0.113.7"},
+		},
+		{
+			name:       "right to left",
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.4, 10.0.0.1"},
+			want:       "198.51.100.4",
+			hops:       []string{"1.1.1.1", "198.51.100.4", "10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:       "real ip",
+			header:     HeaderRealIP,
+			remoteAddr: "192.0.2.1:4000",
+			headers:    map[string]string{"X-Real-Ip": "198.51.100.4"},
+			want:       "198.51.100.4",
+			hops:       []string{"198.51.100.4", "192.0.2.1"},
+		},
+		{
+			name:       "forwarded",
+			header:     HeaderForwarded,
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::17%eth0]:4711";proto=https, for=10.1.1.1;by=_proxy`,
+				"X-Forwarded-For": "1.1.1.1",
+			},
+			want: "2001:db8::17",
+			hops: []string{"2001:db8::17", "10.1.1.1", "2001:db8:ffff::1"},
+		},
+		{
+			name:       "obfuscated hop",
+			header:     HeaderForwarded,
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.4, for=_hidden, for=10.0.0.1"},
+			want:       "10.0.0.1",
+			hops:       []string{"198.51.100.4", "10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:       "client sent forwarded header",
+			remoteAddr: "10.0.0.5:4000",
+			headers:    map[string]string{"Forwarded": "for=6.6.6.6", "X-Forwarded-For": "203.0.113.9"},
+			want:       "203.0.113.9",
+			hops:       []string{"203.0.113.9", "10.0.0.5"},
+		},
+		{
+			name:       "client sent forwarded for",
+			header:     HeaderForwarded,
+			remoteAddr: "10.0.0.5:4000",
+			headers:    map[string]string{"Forwarded": "for=203.0.113.9", "X-Forwarded-For": "6.6.6.6", "X-Real-Ip": "6.6.6.6"},
+			want:       "203.0.113.9",
+			hops:       []string{"203.0.113.9", "10.0.0.5"},
+		},
+		{
+			name:       "client sent real ip",
+			remoteAddr: "10.0.0.5:4000",
+			headers:    map[string]string{"X-Real-Ip": "6.6.6.6"},
+			want:       "10.0.0.5",
+			hops:       []string{"10.0.0.5"},
+		},
+		{
+			name:       "mapped ipv4",
+			remoteAddr: "[::ffff:203.0.113.7]:4000",
+			want:       "203.0.113.7",
+			hops:       []string{"203.0.113.7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			res := &Resolver{TrustedProxies: proxies, Header: tt.header}
+			client := res.Resolve(r)
+			assert.Equal(t, tt.want, client.IP.String())
+			var hops []string
+			for _, hop := range client.Hops {
+				hops = append(hops, hop.String())
+			}
+			assert.Equal(t, tt.hops, hops)
+		})
+	}
+}
+
+func TestGetDeviceFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.4")
+	r.Header.Set("User-Agent", "firefox")
+
+	d := GetDeviceFromRequest(r)
+	assert.Equal(t, "10.0.0.2", d.IPv4, "the default resolver trusts no proxies")
+
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+	d = GetDeviceFromRequest(r.WithContext(WithResolver(r.Context(), &Resolver{TrustedProxies: proxies})))
+	assert.Equal(t, "198.51.100.4", d.IPv4)
+	assert.Empty(t, d.IPv6)
+	assert.Equal(t, []string{"198.51.100.4", "10.0.0.2"}, d.Hops)
+	assert.Equal(t, "firefox", d.UserAgent)
+}
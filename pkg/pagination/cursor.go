@@ -0,0 +1,173 @@
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	CursorQueryParam = "cursor"
+	CursorNext       = "next"
+	CursorPrev       = "prev"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a keyset page, Keys holds the sort key values of the row
+// the page starts after. Numbers decode as json.Number to keep int64 keys exact.
+type Cursor struct {
+	Keys      []interface{} `json:"k"`
+	Direction string        `json:"d,omitempty"`
+}
+
+// CursorPage is the cursor block of a keyset paginated request and response.
+type CursorPage struct {
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Limit      uint   `json:"limit"`
+
+	position *Cursor
+	codec    *CursorCodec
+}
+
+// CursorCodec encodes cursors as opaque base64 strings, signed with HMAC-SHA256 when a key is set.
+type CursorCodec struct {
+	key []byte
+}
+
+func NewCursorCodec(key []byte) *CursorCodec {
+	return &CursorCodec{key: key}
+}
+
+func (c *CursorCodec) Encode(cursor *Cursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	if len(c.key) == 0 {
+		return encoded, nil
+	}
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded)), nil
+}
+
+func (c *CursorCodec) Decode(value string) (*Cursor, error) {
+	encoded, signature, signed := strings.Cut(value, ".")
+	if len(c.key) > 0 {
+		sig, err := base64.RawURLEncoding.DecodeString(signature)
+		if !signed || err != nil || !hmac.Equal(sig, c.sign(encoded)) {
+			return nil, ErrInvalidCursor
+		}
+	} else if signed {
+		return nil, ErrInvalidCursor
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var cursor Cursor
+	if err = decoder.Decode(&cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Direction == "" {
+		cursor.Direction = CursorNext
+	}
+	if cursor.Direction != CursorNext && cursor.Direction != CursorPrev {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func (c *CursorCodec) sign(value string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// FromRequest reads the cursor and limit (or items_per_page) query params of the request.
+func (c *CursorCodec) FromRequest(r *http.Request) (*CursorPage, error) {
+	q := r.URL.Query()
+	page := &CursorPage{Cursor: q.Get(CursorQueryParam), Limit: MaxItemsPerPage, codec: c}
+	limit := q.Get("limit")
+	if limit == "" {
+		limit = q.Get("items_per_page")
+	}
+	if v, err := strconv.Atoi(limit); err == nil && v > 0 && v < MaxItemsPerPage {
+		page.Limit = uint(v)
+	}
+	if page.Cursor != "" {
+		position, err := c.Decode(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		page.position = position
+	}
+	return page, nil
+}
+
+// After returns the sort key values the page starts after, nil on the first page.
+func (page *CursorPage) After() []interface{} {
+	if page.position == nil {
+		return nil
+	}
+	return page.position.Keys
+}
+
+// Backward reports whether the page is read towards the start, the query should then use the
+// reversed comparison and sort order. FinishCursorPage restores the order of the rows.
+func (page *CursorPage) Backward() bool {
+	return page.position != nil && page.position.Direction == CursorPrev
+}
+
+// QueryLimit is the number of rows to fetch, one more than Limit to detect if there are more rows.
+func (page *CursorPage) QueryLimit() uint {
+	return page.Limit + 1
+}
+
+// FinishCursorPage trims rows fetched with QueryLimit to the page and sets the next and previous
+// cursors from the sort keys of the last and first row.
+func FinishCursorPage[T any](page *CursorPage, rows []T, keys func(row T) []interface{}) ([]T, error) {
+	more := uint(len(rows)) > page.Limit
+	if more {
+		rows = rows[:page.Limit]
+	}
+	backward := page.Backward()
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	page.HasMore = more
+	page.NextCursor, page.PrevCursor = "", ""
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	codec := page.codec
+	if codec == nil {
+		codec = &CursorCodec{}
+	}
+	var err error
+	if backward || more {
+		if page.NextCursor, err = codec.Encode(&Cursor{Keys: keys(rows[len(rows)-1]), Direction: CursorNext}); err != nil {
+			return nil, err
+		}
+	}
+	if (backward && more) || (!backward && page.position != nil) {
+		if page.PrevCursor, err = codec.Encode(&Cursor{Keys: keys(rows[0]), Direction: CursorPrev}); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
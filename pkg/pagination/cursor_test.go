@@ -0,0 +1,113 @@
+package pagination
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cursorRow struct {
+	ID int64 `json:"id"`
+}
+
+// queryRows mimics a keyset query: WHERE id > ? ORDER BY id, or WHERE id < ? ORDER BY id DESC backwards.
+func queryRows(t *testing.T, table []cursorRow, page *CursorPage) []cursorRow {
+	var after int64 = -1
+	if keys := page.After(); len(keys) == 1 {
+		v, err := keys[0].(json.Number).Int64()
+		require.NoError(t, err)
+		after = v
+	}
+	var rows []cursorRow
+	if page.Backward() {
+		for i := len(table) - 1; i >= 0 && uint(len(rows)) < page.QueryLimit(); i-- {
+			if table[i].ID < after {
+				rows = append(rows, table[i])
+			}
+		}
+		return rows
+	}
+	for _, row := range table {
+		if row.ID > after && uint(len(rows)) < page.QueryLimit() {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func TestCursorPagination(t *testing.T) {
+	var table []cursorRow
+	for i := int64(1); i <= 7; i++ {
+		table = append(table, cursorRow{ID: i})
+	}
+	codec := NewCursorCodec([]byte("secret"))
+	keys := func(row cursorRow) []interface{} { return []interface{}{row.ID} }
+
+	read := func(cursor string) ([]cursorRow, *CursorPage) {
+		q := url.Values{"limit": {"3"}}
+		if cursor != "" {
+			q.Set(CursorQueryParam, cursor)
+		}
+		page, err := codec.FromRequest(httptest.NewRequest(http.MethodGet, "/items?"+q.Encode(), nil))
+		require.NoError(t, err)
+		rows, err := FinishCursorPage(page, queryRows(t, table, page), keys)
+		require.NoError(t, err)
+		return rows, page
+	}
+	ids := func(rows []cursorRow) string {
+		s := ""
+		for _, r := range rows {
+			s += strconv.FormatInt(r.ID, 10)
+		}
+		return s
+	}
+
+	rows, first := read("")
+	assert.Equal(t, "123", ids(rows))
+	assert.True(t, first.HasMore)
+	assert.Empty(t, first.PrevCursor)
+
+	rows, second := read(first.NextCursor)
+	assert.Equal(t, "456", ids(rows))
+	assert.True(t, second.HasMore)
+
+	rows, last := read(second.NextCursor)
+	assert.Equal(t, "7", ids(rows))
+	assert.False(t, last.HasMore)
+	assert.Empty(t, last.NextCursor)
+
+	rows, back := read(last.PrevCursor)
+	assert.Equal(t, "456", ids(rows))
+	assert.True(t, back.HasMore)
+	assert.NotEmpty(t, back.NextCursor)
+
+	rows, _ = read(back.PrevCursor)
+	assert.Equal(t, "123", ids(rows))
+}
+
+func TestCursorCodec(t *testing.T) {
+	signed := NewCursorCodec([]byte("secret"))
+	value, err := signed.Encode(&Cursor{Keys: []interface{}{int64(9007199254740993), "b"}})
+	require.NoError(t, err)
+
+	cursor, err := signed.Decode(value)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{json.Number("9007199254740993"), "b"}, cursor.Keys)
+	assert.Equal(t, CursorNext, cursor.Direction)
+
+	_, err = NewCursorCodec([]byte("other")).Decode(value)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = NewCursorCodec(nil).Decode(value)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = signed.Decode("not-a-cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = signed.FromRequest(httptest.NewRequest(http.MethodGet, "/items?cursor=abc", nil))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
@@ -3,6 +3,7 @@ package pagination
 import (
 	"encoding/json"
 	"github.com/tidwall/gjson"
+	"math"
 	"net/http"
 	"strconv"
 )
@@ -62,3 +63,34 @@ func GeneratePagination(r *http.Request) *Pagination {
 	}
 	return p
 }
+
+// setTotal sets the total number of items and the page counts derived from it.
+func (p *Pagination) setTotal(total uint) {
+	p.TotalItems = total
+	if p.ItemsPerPage == 0 {
+		p.ItemsPerPage = MaxItemsPerPage
+	}
+	if p.CurrentPage <= 0 {
+		p.CurrentPage = 1
+	}
+	if p.TotalItems < p.ItemsPerPage {
+		p.TotalPages = 1
+	} else {
+		p.TotalPages = uint(math.Ceil(float64(p.TotalItems) / float64(p.ItemsPerPage)))
+	}
+	p.NextPage = p.CurrentPage + 1
+	if p.NextPage > p.TotalPages {
+		p.NextPage = p.TotalPages
+	}
+	if p.CurrentPage > p.TotalPages {
+		p.CurrentPage = p.TotalPages
+	}
+}
+
+// Offset is the number of items before the current page, for use in LIMIT/OFFSET queries.
+func (p *Pagination) Offset() uint {
+	if p.CurrentPage <= 1 {
+		return 0
+	}
+	return (p.CurrentPage - 1) * p.ItemsPerPage
+}
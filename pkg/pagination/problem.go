@@ -0,0 +1,187 @@
+package pagination
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Seann-Moser/cutil/logc"
+	"github.com/Seann-Moser/rutil"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	ProblemTypeDefault = "about:blank"
+)
+
+// Problem is a RFC 9457 problem details object. Extensions are written as top level members.
+type Problem struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	TraceID    string                 `json:"trace_id,omitempty"`
+	Errors     rutil.ValidationErrors `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	b, err := json.Marshal((*problem)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return b, err
+	}
+	output := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		output[k] = v
+	}
+	// the standard members win over extensions with the same name
+	var members map[string]interface{}
+	if err = json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range members {
+		output[k] = v
+	}
+	return json.Marshal(output)
+}
+
+// HTTPError is an error that carries the status and problem details a handler wants returned.
+// Detail is always shown to the client, the wrapped Err only when the response shows errors.
+type HTTPError struct {
+	Status     int
+	Type       string
+	Title      string
+	Detail     string
+	Err        error
+	Extensions map[string]interface{}
+}
+
+func NewHTTPError(status int, detail string, err error) *HTTPError {
+	return &HTTPError{Status: status, Detail: detail, Err: err}
+}
+
+func NotFound(detail string, err error) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, detail, err)
+}
+
+func Conflict(detail string, err error) *HTTPError {
+	return NewHTTPError(http.StatusConflict, detail, err)
+}
+
+func Forbidden(detail string, err error) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, detail, err)
+}
+
+// Validation wraps the rutil.ValidationErrors in err as a 400 error.
+func Validation(err error) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, "request validation failed", err)
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode maps an error to the status code it should be returned with.
+// HTTPError uses its Status, validation errors are a 400, sql.ErrNoRows a 404 and everything else a 500.
+func StatusCode(err error) int {
+	var httpErr *HTTPError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &httpErr) && httpErr.Status != 0:
+		return httpErr.Status
+	case errors.As(err, new(rutil.ValidationErrors)):
+		return http.StatusBadRequest
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// NewProblem builds the problem details for err. When showErr is false only the Detail of a
+// HTTPError and validation errors are returned to the client.
+func NewProblem(ctx context.Context, r *http.Request, err error, showErr bool) *Problem {
+	status := StatusCode(err)
+	p := &Problem{
+		Type:    ProblemTypeDefault,
+		Title:   http.StatusText(status),
+		Status:  status,
+		TraceID: traceID(ctx),
+	}
+	if r != nil && r.URL != nil {
+		p.Instance = r.URL.Path
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if httpErr.Type != "" {
+			p.Type = httpErr.Type
+		}
+		if httpErr.Title != "" {
+			p.Title = httpErr.Title
+		}
+		p.Detail = httpErr.Detail
+		p.Extensions = httpErr.Extensions
+	}
+	if fieldErrors, ok := rutil.IsValidationError(err); ok {
+		p.Errors = fieldErrors
+	}
+	if showErr && err != nil {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+// Problem writes err as application/problem+json using StatusCode for the status.
+func (resp *Response) Problem(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	p := NewProblem(ctx, r, err, resp.showError)
+	if p.Status >= http.StatusInternalServerError {
+		logc.Error(ctx, p.Title, zap.Error(err), zap.Int("code", p.Status))
+	}
+	resp.ProblemDetails(ctx, w, p)
+}
+
+// ProblemDetails writes p as application/problem+json.
+func (resp *Response) ProblemDetails(ctx context.Context, w http.ResponseWriter, p *Problem) {
+	if p.Type == "" {
+		p.Type = ProblemTypeDefault
+	}
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.TraceID == "" {
+		p.TraceID = traceID(ctx)
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logc.Warn(ctx, "failed encoding response", zap.Error(err))
+	}
+}
+
+func traceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
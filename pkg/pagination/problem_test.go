@@ -0,0 +1,94 @@
+package pagination
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Seann-Moser/rutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, http.StatusOK},
+		{NotFound("missing", nil), http.StatusNotFound},
+		{fmt.Errorf("wrapped: %w", Conflict("exists", nil)), http.StatusConflict},
+		{Forbidden("no", nil), http.StatusForbidden},
+		{Validation(rutil.ValidationErrors{{Path: "name"}}), http.StatusBadRequest},
+		{rutil.ValidationErrors{{Path: "name"}}, http.StatusBadRequest},
+		{fmt.Errorf("query: %w", sql.ErrNoRows), http.StatusNotFound},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, StatusCode(tt.err), "%v", tt.err)
+	}
+}
+
+func TestResponseProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		showErr    bool
+		err        error
+		wantStatus int
+		wantDetail string
+		wantErrors int
+	}{
+		{"not found detail", false, NotFound("item 1 not found", errors.New("sql: no rows")), http.StatusNotFound, "item 1 not found", 0},
+		{"internal hidden", false, errors.New("password=secret"), http.StatusInternalServerError, "", 0},
+		{"internal shown", true, errors.New("boom"), http.StatusInternalServerError, "boom", 0},
+		{"validation", false, rutil.ValidationErrors{{Path: "name", Rule: "required", Message: "is required"}}, http.StatusBadRequest, "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewResponse(tt.showErr).Problem(context.Background(), w, httptest.NewRequest(http.MethodGet, "/items/1", nil), tt.err)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+			var p map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Equal(t, ProblemTypeDefault, p["type"])
+			assert.Equal(t, float64(tt.wantStatus), p["status"])
+			assert.Equal(t, "/items/1", p["instance"])
+			if tt.wantDetail == "" {
+				assert.NotContains(t, p, "detail")
+			} else {
+				assert.Equal(t, tt.wantDetail, p["detail"])
+			}
+			if tt.wantErrors > 0 {
+				assert.Len(t, p["errors"], tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestProblemExtensions(t *testing.T) {
+	b, err := json.Marshal(&Problem{Type: ProblemTypeDefault, Title: "Conflict", Status: http.StatusConflict, Extensions: map[string]interface{}{"id": "1", "status": 1}})
+	require.NoError(t, err)
+	var p map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &p))
+	assert.Equal(t, "1", p["id"])
+	assert.Equal(t, float64(http.StatusConflict), p["status"])
+}
+
+func TestResponseErrorProblemJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewResponse(false).SetProblemJSON(true).Error(context.Background(), w, errors.New("hidden"), http.StatusForbidden, "forbidden")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "hidden")
+
+	w = httptest.NewRecorder()
+	NewResponse(true).Error(context.Background(), w, errors.New("shown"), http.StatusBadRequest, "bad")
+	assert.Contains(t, w.Body.String(), `"data":"shown"`)
+}
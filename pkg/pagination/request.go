@@ -1,10 +1,12 @@
 package pagination
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Seann-Moser/cutil/logc"
+	"github.com/Seann-Moser/rutil"
 	"io"
 	"math"
 	"mime"
@@ -120,11 +122,30 @@ func round(val float64, roundOn float64, places int) (newVal float64) {
 	return
 }
 
+// BodyValidator is run by GetBody on every decoded body, set it to nil to disable validation.
+var BodyValidator = rutil.Validate
+
 func GetBody[T any](r *http.Request) (*T, error) {
 	var d T
 	err := json.NewDecoder(r.Body).Decode(&d)
 	if err != nil {
 		return nil, fmt.Errorf("failed decoding body: %s", err)
 	}
+	if BodyValidator != nil {
+		if err := BodyValidator(&d); err != nil {
+			return nil, err
+		}
+	}
 	return &d, nil
 }
+
+// ReadBody decodes and validates the body with GetBody and writes a 400 response when it fails.
+// Failed validation rules are always returned to the caller as field details.
+func ReadBody[T any](ctx context.Context, resp *Response, w http.ResponseWriter, r *http.Request) (*T, bool) {
+	d, err := GetBody[T](r)
+	if err != nil {
+		resp.Error(ctx, w, err, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	return d, true
+}
@@ -5,10 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Seann-Moser/cutil/logc"
+	"github.com/Seann-Moser/rutil"
 	"io"
-	"math"
 	"net/http"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -17,33 +18,51 @@ import (
 )
 
 type Response struct {
-	showError bool
+	showError   bool
+	problemJSON bool
 }
 
 type BaseResponseGeneric[T any] struct {
 	Message string      `json:"message"`
 	Data    T           `json:"data,omitempty"`
 	Page    *Pagination `json:"page,omitempty"`
+	Cursor  *CursorPage `json:"cursor,omitempty"`
 }
 
 type BaseResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 	Page    *Pagination `json:"page,omitempty"`
+	Cursor  *CursorPage `json:"cursor,omitempty"`
 }
 
 func NewResponse(showErr bool) *Response {
 	return &Response{showError: showErr}
 }
 
+// SetProblemJSON makes Error write application/problem+json responses instead of BaseResponse.
+func (resp *Response) SetProblemJSON(enabled bool) *Response {
+	resp.problemJSON = enabled
+	return resp
+}
+
 func (resp *Response) Error(ctx context.Context, w http.ResponseWriter, err error, code int, message string) {
-	w.WriteHeader(code)
 	if err != nil {
 		logc.Error(ctx, message, zap.Error(err), zap.Int("code", code))
 	}
-	var dataErr error
-	if err != nil && resp.showError {
-		dataErr = err
+	if resp.problemJSON {
+		p := NewProblem(ctx, nil, err, resp.showError)
+		p.Status = code
+		p.Title = message
+		resp.ProblemDetails(ctx, w, p)
+		return
+	}
+	w.WriteHeader(code)
+	var dataErr interface{}
+	if fieldErrors, ok := rutil.IsValidationError(err); ok {
+		dataErr = fieldErrors
+	} else if err != nil && resp.showError {
+		dataErr = err.Error()
 	}
 	EncodeErr := json.NewEncoder(w).Encode(BaseResponse{
 		Message: message,
@@ -55,22 +74,42 @@ func (resp *Response) Error(ctx context.Context, w http.ResponseWriter, err erro
 }
 
 func (resp *Response) PaginationResponse(ctx context.Context, w http.ResponseWriter, data interface{}, page *Pagination) {
-	d, err := json.Marshal(data)
-	if err != nil {
-		logc.Error(ctx, "failed to marshall data", zap.Error(err))
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		resp.Error(ctx, w, fmt.Errorf("pagination requires a slice, got %T", data), http.StatusInternalServerError, "failed paginating response")
 		return
 	}
-	var pageData []interface{}
-	err = json.Unmarshal(d, &pageData)
-	if err != nil {
-		logc.Error(ctx, "failed to encode to []interface", zap.Error(err))
-		return
+	pageData := make([]interface{}, v.Len())
+	for i := range pageData {
+		pageData[i] = v.Index(i).Interface()
 	}
-	w.WriteHeader(http.StatusOK)
-	bytes, err := json.MarshalIndent(BaseResponse{
+	writePage(ctx, w, BaseResponseGeneric[[]interface{}]{
 		Data: getRange(pageData, page),
 		Page: page,
-	}, "", "    ")
+	})
+}
+
+// PaginatedResponse writes the page of items selected by page.
+func PaginatedResponse[T any](ctx context.Context, w http.ResponseWriter, items []T, page *Pagination) {
+	writePage(ctx, w, BaseResponseGeneric[[]T]{
+		Data: getRange(items, page),
+		Page: page,
+	})
+}
+
+// PrePagedResponse writes items that were already limited to page, for example by a LIMIT/OFFSET
+// query, using total as the number of items across all pages.
+func PrePagedResponse[T any](ctx context.Context, w http.ResponseWriter, items []T, page *Pagination, total uint) {
+	page.setTotal(total)
+	writePage(ctx, w, BaseResponseGeneric[[]T]{
+		Data: items,
+		Page: page,
+	})
+}
+
+func writePage[T any](ctx context.Context, w http.ResponseWriter, body BaseResponseGeneric[T]) {
+	w.WriteHeader(http.StatusOK)
+	bytes, err := json.MarshalIndent(body, "", "    ")
 	if err != nil {
 		logc.Error(ctx, "failed to encode response")
 	}
@@ -80,29 +119,24 @@ func (resp *Response) PaginationResponse(ctx context.Context, w http.ResponseWri
 	}
 }
 
-func getRange(data []interface{}, page *Pagination) []interface{} {
-	page.TotalItems = uint(len(data))
-	if page.ItemsPerPage == 0 {
-		page.ItemsPerPage = MaxItemsPerPage
-	}
-	if page.ItemsPerPage <= 0 {
-		page.ItemsPerPage = 1
-	}
-	if page.CurrentPage <= 0 {
-		page.CurrentPage = 1
-	}
-	if page.TotalItems < page.ItemsPerPage {
-		page.TotalPages = 1
-	} else {
-		page.TotalPages = uint(math.Ceil(float64(page.TotalItems) / float64(page.ItemsPerPage)))
-	}
-	page.NextPage = page.CurrentPage + 1
-	if page.NextPage > page.TotalPages {
-		page.NextPage = page.TotalPages
+// CursorResponse writes a page of data read with a CursorPage, see FinishCursorPage.
+func (resp *Response) CursorResponse(ctx context.Context, w http.ResponseWriter, data interface{}, page *CursorPage) {
+	w.WriteHeader(http.StatusOK)
+	bytes, err := json.MarshalIndent(BaseResponse{
+		Data:   data,
+		Cursor: page,
+	}, "", "    ")
+	if err != nil {
+		logc.Error(ctx, "failed to encode response")
 	}
-	if page.CurrentPage > page.TotalPages {
-		page.CurrentPage = page.TotalPages
+	_, EncodeErr := w.Write(bytes)
+	if EncodeErr != nil {
+		logc.Warn(ctx, "failed encoding response", zap.Error(EncodeErr))
 	}
+}
+
+func getRange[T any](data []T, page *Pagination) []T {
+	page.setTotal(uint(len(data)))
 	if len(data) < int(page.ItemsPerPage) {
 		return data
 	}
@@ -112,7 +146,7 @@ func getRange(data []interface{}, page *Pagination) []interface{} {
 	}
 	max := min + int(page.ItemsPerPage)
 	if min > len(data) {
-		return []interface{}{}
+		return []T{}
 	}
 	if max > len(data) {
 		return data[min:]
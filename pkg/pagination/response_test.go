@@ -0,0 +1,80 @@
+package pagination
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pageItem struct {
+	ID int `json:"id"`
+}
+
+func pageItems(n int) []pageItem {
+	items := make([]pageItem, n)
+	for i := range items {
+		items[i] = pageItem{ID: i + 1}
+	}
+	return items
+}
+
+func decodePage(t *testing.T, w *httptest.ResponseRecorder) BaseResponseGeneric[[]pageItem] {
+	var body BaseResponseGeneric[[]pageItem]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+func TestPaginatedResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     int
+		page      Pagination
+		wantFirst int
+		wantLen   int
+		wantPage  Pagination
+	}{
+		{"first page", 25, Pagination{CurrentPage: 1, ItemsPerPage: 10}, 1, 10, Pagination{CurrentPage: 1, NextPage: 2, TotalItems: 25, TotalPages: 3, ItemsPerPage: 10}},
+		{"last page", 25, Pagination{CurrentPage: 3, ItemsPerPage: 10}, 21, 5, Pagination{CurrentPage: 3, NextPage: 3, TotalItems: 25, TotalPages: 3, ItemsPerPage: 10}},
+		{"past the end", 25, Pagination{CurrentPage: 9, ItemsPerPage: 10}, 21, 5, Pagination{CurrentPage: 3, NextPage: 3, TotalItems: 25, TotalPages: 3, ItemsPerPage: 10}},
+		{"fewer than a page", 3, Pagination{ItemsPerPage: 10}, 1, 3, Pagination{CurrentPage: 1, NextPage: 1, TotalItems: 3, TotalPages: 1, ItemsPerPage: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := tt.page
+			w := httptest.NewRecorder()
+			PaginatedResponse(context.Background(), w, pageItems(tt.items), &page)
+			assert.Equal(t, http.StatusOK, w.Code)
+			body := decodePage(t, w)
+			require.Len(t, body.Data, tt.wantLen)
+			assert.Equal(t, tt.wantFirst, body.Data[0].ID)
+			assert.Equal(t, tt.wantPage, *body.Page)
+		})
+	}
+}
+
+func TestPrePagedResponse(t *testing.T) {
+	page := &Pagination{CurrentPage: 2, ItemsPerPage: 10}
+	assert.Equal(t, uint(10), page.Offset())
+
+	w := httptest.NewRecorder()
+	PrePagedResponse(context.Background(), w, pageItems(10), page, 42)
+	body := decodePage(t, w)
+	assert.Len(t, body.Data, 10)
+	assert.Equal(t, Pagination{CurrentPage: 2, NextPage: 3, TotalItems: 42, TotalPages: 5, ItemsPerPage: 10}, *body.Page)
+}
+
+func TestPaginationResponseNonSlice(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewResponse(false).PaginationResponse(context.Background(), w, map[string]int{"a": 1}, &Pagination{})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = httptest.NewRecorder()
+	NewResponse(false).PaginationResponse(context.Background(), w, pageItems(3), &Pagination{CurrentPage: 1, ItemsPerPage: 2})
+	body := decodePage(t, w)
+	assert.Equal(t, []pageItem{{ID: 1}, {ID: 2}}, body.Data)
+}
@@ -2,6 +2,8 @@ package rbac
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/Seann-Moser/cutil/cachec"
 	"github.com/Seann-Moser/cutil/logc"
@@ -11,6 +13,7 @@ import (
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -22,6 +25,7 @@ var _ RBAC = &Impl{}
 
 type Impl struct {
 	validResourceName *regexp.Regexp
+	txBeginner        TxBeginner
 }
 
 func Flags() *pflag.FlagSet {
@@ -29,13 +33,23 @@ func Flags() *pflag.FlagSet {
 	return fs
 }
 
+// New returns a RBAC backed by the tables of InitTables. The Replace* methods run in a
+// transaction and return ErrNoTxBeginner until SetTxBeginner is called.
 func New() *Impl {
 
 	return &Impl{
-		validResourceName: regexp.MustCompile(`^([a-z0-9_\-{}]{2,}\.*)+$`),
+		validResourceName: regexp.MustCompile(validResourceNamePattern),
 	}
 }
 
+// SetTxBeginner sets the database the Replace* methods start their transactions on.
+func (r *Impl) SetTxBeginner(db TxBeginner) *Impl {
+	r.txBeginner = db
+	return r
+}
+
+// InitTables adds the rbac tables to ctx. The DAO is not used for transactions, pass its
+// database to SetTxBeginner to enable the Replace* methods.
 func (r *Impl) InitTables(ctx context.Context, dao *sqlc.DAO) (context.Context, error) {
 	ctx, err := sqlc.AddTable[RoleGroup](ctx, dao, queryDatabase, queryType)
 	if err != nil {
@@ -181,9 +195,21 @@ func (r *Impl) RemoveGroupFromUser(ctx context.Context, group *RoleGroup, userID
 	return table.Delete(ctx, nil, ug)
 }
 
-func (r *Impl) ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) error {
-	//TODO implement me
-	panic("implement me")
+// ReplaceGroupInUser makes group the only group of the user, keeping the user type of its
+// current groups.
+func (r *Impl) ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) (*ReplaceResult, error) {
+	if group == nil || group.ID == "" {
+		return nil, fmt.Errorf("invalid group")
+	}
+	return replaceIDs[UserGroup](ctx, r.txBeginner,
+		map[string]string{"user_id": userID},
+		[]string{group.ID},
+		func(row *UserGroup) string { return row.GroupID },
+		func(id string, current []*UserGroup) (UserGroup, error) {
+			userType := currentUserType(current, func(row *UserGroup) string { return row.UserType })
+			return UserGroup{GroupID: id, UserID: userID, UserType: userType}, nil
+		},
+	)
 }
 func (r *Impl) GetUserGroupWithType(ctx context.Context, userID string, userType string) ([]*UserGroup, error) {
 	groups, err := r.GetAllGroupsForUser(ctx, userID)
@@ -241,9 +267,21 @@ func (r *Impl) RemoveRoleFromUser(ctx context.Context, role *Role, userID string
 	return table.Delete(ctx, nil, ur)
 }
 
-func (r *Impl) ReplaceRoleInUser(ctx context.Context, role *Role, userID string) error {
-	//TODO implement me
-	panic("implement me")
+// ReplaceRoleInUser makes role the only role of the user, keeping the user type of its
+// current roles.
+func (r *Impl) ReplaceRoleInUser(ctx context.Context, role *Role, userID string) (*ReplaceResult, error) {
+	if role == nil || role.ID == "" {
+		return nil, fmt.Errorf("invalid role")
+	}
+	return replaceIDs[UserRole](ctx, r.txBeginner,
+		map[string]string{"user_id": userID},
+		[]string{role.ID},
+		func(row *UserRole) string { return row.RoleID },
+		func(id string, current []*UserRole) (UserRole, error) {
+			userType := currentUserType(current, func(row *UserRole) string { return row.UserType })
+			return UserRole{RoleID: id, UserID: userID, UserType: userType}, nil
+		},
+	)
 }
 
 func (r *Impl) AddRoleToGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error {
@@ -326,9 +364,26 @@ func (r *Impl) RemoveRoleFromGroup(ctx context.Context, group *RoleGroup, roles
 
 }
 
-func (r *Impl) ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error {
-	//TODO implement me
-	panic("implement me")
+// ReplaceRoleInGroup makes roles the exact set of roles in the group.
+func (r *Impl) ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) (*ReplaceResult, error) {
+	if group == nil || group.ID == "" {
+		return nil, fmt.Errorf("invalid group")
+	}
+	roleIDs := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if role == nil || role.ID == "" {
+			return nil, fmt.Errorf("invalid role")
+		}
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return replaceIDs[RolesInGroup](ctx, r.txBeginner,
+		map[string]string{"group_id": group.ID},
+		roleIDs,
+		func(row *RolesInGroup) string { return row.RoleID },
+		func(id string, _ []*RolesInGroup) (RolesInGroup, error) {
+			return RolesInGroup{GroupID: group.ID, RoleID: id}, nil
+		},
+	)
 }
 
 func (r *Impl) GetRole(ctx context.Context, roleID string) (*Role, error) {
@@ -544,42 +599,51 @@ func (r *Impl) UserHasRole(ctx context.Context, userID string, role *Role) (bool
 	return false, outputErr
 }
 
+// UserHasAllRoles reports whether the user has every role, directly or through its groups, or
+// inside one of its accounts.
 func (r *Impl) UserHasAllRoles(ctx context.Context, userID string, roles ...*Role) (bool, error) {
-	var roleIDs []string
-	for _, role := range roles {
-		roleIDs = append(roleIDs, role.ID)
+	if len(roles) == 0 {
+		return false, nil
 	}
-
-	var outputErr error
+	var userRoles []*Role
 	q := sqlc.GetQuery[UserRole](ctx)
 	q.Where(q.Column("user_id"), "=", "", 0, userID)
-	q.Where(q.Column("role_id"), "in", "", 0, strings.Join(roleIDs, ","))
-	if data, err := q.Run(ctx, nil); err == nil && len(data) > 0 {
-		return true, nil
-	} else {
-		outputErr = multierr.Combine(outputErr)
+	rows, err := q.Run(ctx, nil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	for _, row := range rows {
+		userRoles = append(userRoles, &Role{ID: row.RoleID})
 	}
 	userGroupTable, err := sqlc.GetTableCtx[UserGroup](ctx)
 	if err != nil {
 		return false, err
 	}
-
 	qrig := sqlc.GetQuery[RolesInGroup](ctx)
 	qrig.Join(userGroupTable.GetColumns(), "")
 	qrig.Where(userGroupTable.GetColumn("user_id"), "=", "", 0, userID)
-	qrig.Where(qrig.Column("role_id"), "in", "", 0, strings.Join(roleIDs, ","))
-	if data, err := qrig.Run(ctx, nil); err == nil && len(data) > 0 {
+	groupRoles, err := qrig.Run(ctx, nil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	for _, row := range groupRoles {
+		userRoles = append(userRoles, &Role{ID: row.RoleID})
+	}
+	if containsAllRoles(userRoles, roles) {
 		return true, nil
-	} else {
-		outputErr = multierr.Combine(outputErr)
 	}
 	accounts, _ := r.GetAccountsForUser(ctx, userID)
+	seen := map[string]bool{}
 	for _, account := range accounts {
-		if hasRole, _ := r.AccountUserHasAllRoles(ctx, account.AccountID, userID, roles...); hasRole {
+		if seen[account.AccountID] {
+			continue
+		}
+		seen[account.AccountID] = true
+		if hasRoles, _ := r.AccountUserHasAllRoles(ctx, account.AccountID, userID, roles...); hasRoles {
 			return true, nil
 		}
 	}
-	return false, outputErr
+	return false, nil
 }
 
 func (r *Impl) UserHasAnyRoles(ctx context.Context, userID, accountID string, roles ...*Role) (bool, error) {
@@ -661,15 +725,14 @@ func GetResourceIDs(resource ...*Resource) []string {
 }
 
 func (r *Impl) RoleHasPermission(ctx context.Context, role *Role, resource *Resource, access ...int) (bool, error) {
-	//todo fix this matching incorrectly on some resources due to regex
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.UseCache()
 	q.Where(q.Column("role_id"), "=", "AND", 0, role.ID)
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resource), ","))
 	rows, err := q.Run(ctx, nil)
 	if err != nil {
 		return false, err
 	}
+	rows = MatchingPermissions(rows, resource.ID)
 	logc.Debug(ctx, "role has permissions query", zap.String("query", q.Query), zap.Any("args", q.Args()), zap.Any("rows", rows))
 	if len(rows) == 0 {
 		return false, fmt.Errorf("role does not have permissions to view this resource (%s)", fmt.Sprintf("%s$", resource.ID))
@@ -696,12 +759,11 @@ func (r *Impl) RoleHasPermission(ctx context.Context, role *Role, resource *Reso
 func (r *Impl) RoleHasAnyPermission(ctx context.Context, role *Role, resources []*Resource, access ...int) (bool, error) {
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.Where(q.Column("role_id"), "=", "AND", 0, role.ID)
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resources...), ","))
 	rows, err := q.Run(ctx, nil)
 	if err != nil {
 		return false, err
 	}
-	for _, row := range rows {
+	for _, row := range matchingPermissionsForResources(rows, resources...) {
 		if HasAccess(row.Access, CombineAccess(access...)) {
 			return true, nil
 		}
@@ -709,21 +771,19 @@ func (r *Impl) RoleHasAnyPermission(ctx context.Context, role *Role, resources [
 	return false, nil
 }
 
+// RoleHasAllPermissions reports whether the role has access to every resource.
 func (r *Impl) RoleHasAllPermissions(ctx context.Context, role *Role, resources []*Resource, access ...int) (bool, error) {
+	if role == nil {
+		return false, fmt.Errorf("invalid role")
+	}
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.UseCache()
 	q.Where(q.Column("role_id"), "=", "AND", 0, role.ID)
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resources...), ","))
 	rows, err := q.Run(ctx, nil)
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return false, err
 	}
-	for _, row := range rows {
-		if HasAccess(row.Access, CombineAccess(access...)) {
-			return true, nil
-		}
-	}
-	return false, nil
+	return rowsHaveAllAccess(rows, resources, CombineAccess(access...)), nil
 }
 
 func (r *Impl) UserHasPermissionForResource(ctx context.Context, userID, accountID string, resource *Resource, access ...int) (bool, error) {
@@ -738,7 +798,6 @@ func (r *Impl) UserHasPermissionForResource(ctx context.Context, userID, account
 
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.Where(q.Column("role_id"), "in", "AND", 0, strings.Join(roleIDs, ","))
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resource), ","))
 	q.UseCache()
 	q.Build()
 
@@ -746,6 +805,7 @@ func (r *Impl) UserHasPermissionForResource(ctx context.Context, userID, account
 	if err != nil {
 		return false, err
 	}
+	rows = MatchingPermissions(rows, resource.ID)
 	if len(rows) == 0 {
 		return false, nil
 	}
@@ -755,7 +815,7 @@ func (r *Impl) UserHasPermissionForResource(ctx context.Context, userID, account
 			return true, nil
 		}
 	}
-	return false, fmt.Errorf("user does not have access to resource")
+	return false, ErrAccessDenied
 }
 
 func (r *Impl) UserHasAnyPermissionForResource(ctx context.Context, userID, accountID string, resources []*Resource, access ...int) (bool, error) {
@@ -770,12 +830,12 @@ func (r *Impl) UserHasAnyPermissionForResource(ctx context.Context, userID, acco
 
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.Where(q.Column("role_id"), "in", "AND", 0, strings.Join(roleIDs, ","))
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resources...), ","))
 	q.UseCache()
 	rows, err := q.Run(ctx, nil)
 	if err != nil {
 		return false, err
 	}
+	rows = matchingPermissionsForResources(rows, resources...)
 	if len(rows) == 0 {
 		return false, nil
 	}
@@ -832,9 +892,26 @@ func (r *Impl) RemovePermissionsFromRole(ctx context.Context, role *Role, resour
 	return nil
 }
 
-func (r *Impl) ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) error {
-	//TODO implement me
-	panic("implement me")
+// ReplacePermissionsInRole replaces the permissions of the role on the resource with a single
+// permission combining access.
+func (r *Impl) ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) (*ReplaceResult, error) {
+	if role == nil || resource == nil {
+		return nil, fmt.Errorf("invalid role or resource")
+	}
+	return replaceIDs[RoleResourcePermissions](ctx, r.txBeginner,
+		map[string]string{"role_id": role.ID, "resource_id": resource.ID},
+		[]string{strconv.Itoa(CombineAccess(access...))},
+		func(row *RoleResourcePermissions) string { return strconv.Itoa(row.Access) },
+		func(id string, _ []*RoleResourcePermissions) (RoleResourcePermissions, error) {
+			combined, err := strconv.Atoi(id)
+			return RoleResourcePermissions{
+				RoleID:          role.ID,
+				ResourcePattern: resource.ID,
+				ResourceID:      resource.ID,
+				Access:          combined,
+			}, err
+		},
+	)
 }
 
 func (r *Impl) NewAccountUserRole(ctx context.Context, accountID string, roleID string, userID string) (*AccountUserRole, error) {
@@ -1019,25 +1096,17 @@ func (r *Impl) AccountUserHasRole(ctx context.Context, accountID, userID string,
 func (r *Impl) AccountUserHasAllRoles(ctx context.Context, accountID, userID string, roles ...*Role) (bool, error) {
 	q := sqlc.GetQuery[AccountUserRole](ctx)
 	//todo check group as well
-	//var roleIDs []string
-	//for _, ur := range roles {
-	//	roleIDs = append(roleIDs, ur.ID)
-	//}
 	q.Where(q.Column("account_id"), "=", "AND", 0, accountID)
 	q.Where(q.Column("user_id"), "=", "AND", 0, userID)
-	for _, role := range roles {
-		q.UniqueWhere(q.Column("role_id"), "=", "AND", 0, role.ID, false)
-
-	}
-	userRoles, err := q.Run(ctx, nil)
-	if err != nil {
+	rows, err := q.Run(ctx, nil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return false, err
 	}
-
-	if len(userRoles) == 0 {
-		return false, nil
+	var userRoles []*Role
+	for _, row := range rows {
+		userRoles = append(userRoles, &Role{ID: row.RoleID})
 	}
-	return true, nil
+	return containsAllRoles(userRoles, roles), nil
 }
 
 func (r *Impl) AccountUserHasAnyRoles(ctx context.Context, accountID, userID string, roles ...*Role) (bool, error) {
@@ -1073,12 +1142,12 @@ func (r *Impl) AccountUserHasPermissionForResource(ctx context.Context, accountI
 	}
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.Where(q.Column("role_id"), "in", "AND", 0, strings.Join(roleIDs, ","))
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resource), ","))
 	q.Build()
 	rows, err := q.Run(ctx, nil)
 	if err != nil {
 		return false, err
 	}
+	rows = MatchingPermissions(rows, resource.ID)
 	logc.Debug(ctx, "AccountUserHasPermissionForResource", zap.String("query", q.Query), zap.Any("args", q.Args()))
 	if len(rows) == 0 {
 		return false, nil
@@ -1089,7 +1158,7 @@ func (r *Impl) AccountUserHasPermissionForResource(ctx context.Context, accountI
 			return true, nil
 		}
 	}
-	return false, fmt.Errorf("user does not have access to resource")
+	return false, ErrAccessDenied
 }
 
 func (r *Impl) AccountUserHasAnyPermissionForResource(ctx context.Context, accountID, userID string, resources []*Resource, access ...int) (bool, error) {
@@ -1103,12 +1172,12 @@ func (r *Impl) AccountUserHasAnyPermissionForResource(ctx context.Context, accou
 	}
 	q := sqlc.GetQuery[RoleResourcePermissions](ctx)
 	q.Where(q.Column("role_id"), "in", "AND", 0, strings.Join(roleIDs, ","))
-	q.Where(q.Column("resource_id"), "in", "AND", 0, strings.Join(GetResourceIDs(resources...), ","))
 	q.UseCache()
 	rows, err := q.Run(ctx, nil)
 	if err != nil {
 		return false, fmt.Errorf("error running query: %w", err)
 	}
+	rows = matchingPermissionsForResources(rows, resources...)
 	if len(rows) == 0 {
 		return false, nil
 	}
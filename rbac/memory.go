@@ -0,0 +1,1072 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var _ RBAC = &Memory{}
+
+// Memory is an in-memory RBAC backend with the same semantics as Impl.
+// It is safe for concurrent use and is intended for tests and local development.
+type Memory struct {
+	validResourceName *regexp.Regexp
+
+	mu                sync.RWMutex
+	groups            map[string]*RoleGroup
+	roles             map[string]*Role
+	resources         map[string]*Resource
+	rolesInGroup      []*RolesInGroup
+	permissions       []*RoleResourcePermissions
+	userRoles         []*UserRole
+	userGroups        []*UserGroup
+	accountUserRoles  []*AccountUserRole
+	accountUserGroups []*AccountUserGroup
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		validResourceName: regexp.MustCompile(validResourceNamePattern),
+		groups:            map[string]*RoleGroup{},
+		roles:             map[string]*Role{},
+		resources:         map[string]*Resource{},
+	}
+}
+
+func memoryTimestamp() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func (m *Memory) NewGroup(ctx context.Context, groupName string, description string) (*RoleGroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if group := m.groupWithName(groupName); group != nil {
+		return copyGroup(group), nil
+	}
+	ts := memoryTimestamp()
+	rg := &RoleGroup{
+		ID:               uuid.New().String(),
+		Name:             groupName,
+		Description:      description,
+		Public:           false,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	}
+	m.groups[rg.ID] = rg
+	return copyGroup(rg), nil
+}
+
+func (m *Memory) NewRole(ctx context.Context, roleName string, description string, priority int) (*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if role := m.roleWithName(roleName); role != nil {
+		return copyRole(role), nil
+	}
+	ts := memoryTimestamp()
+	role := &Role{
+		ID:               uuid.New().String(),
+		Name:             roleName,
+		Description:      description,
+		Priority:         priority,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	}
+	m.roles[role.ID] = role
+	return copyRole(role), nil
+}
+
+func (m *Memory) NewResource(ctx context.Context, resourceID string, description string, resourceType string, data string, public bool) (*Resource, error) {
+	resourceID = strings.ToLower(resourceID)
+	if !m.validResourceName.MatchString(resourceID) {
+		return nil, fmt.Errorf("invalid resource id format(%s)", resourceID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if resource, found := m.resources[resourceID]; found {
+		return copyResource(resource), nil
+	}
+	ts := memoryTimestamp()
+	resource := &Resource{
+		ID:               resourceID,
+		Description:      description,
+		ResourceType:     resourceType,
+		Data:             data,
+		Public:           public,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	}
+	m.resources[resourceID] = resource
+	return copyResource(resource), nil
+}
+
+func (m *Memory) AddGroupToUser(ctx context.Context, group *RoleGroup, userID string, userType string) error {
+	if group == nil || group.ID == "" {
+		return fmt.Errorf("invalid group")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addGroupToUser(group.ID, userID, userType)
+	return nil
+}
+
+func (m *Memory) RemoveGroupFromUser(ctx context.Context, group *RoleGroup, userID string) error {
+	if group == nil || group.ID == "" {
+		return fmt.Errorf("invalid group")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userGroups = filter(m.userGroups, func(ug *UserGroup) bool {
+		return !(ug.UserID == userID && ug.GroupID == group.ID)
+	})
+	return nil
+}
+
+func (m *Memory) ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) (*ReplaceResult, error) {
+	if group == nil || group.ID == "" {
+		return nil, fmt.Errorf("invalid group")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userType := ""
+	var current []string
+	m.userGroups = filter(m.userGroups, func(ug *UserGroup) bool {
+		if ug.UserID != userID {
+			return true
+		}
+		current = append(current, ug.GroupID)
+		if ug.GroupID == group.ID || userType == "" {
+			userType = ug.UserType
+		}
+		return false
+	})
+	m.addGroupToUser(group.ID, userID, userType)
+	return diffIDs(current, []string{group.ID}), nil
+}
+
+func (m *Memory) GetUserGroupWithType(ctx context.Context, userID string, userType string) ([]*UserGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	groupIDs := map[string]bool{}
+	for _, group := range m.groupsForUser(userID) {
+		groupIDs[group.ID] = true
+	}
+	var output []*UserGroup
+	for _, ug := range m.userGroups {
+		if groupIDs[ug.GroupID] && ug.UserType == userType {
+			c := *ug
+			output = append(output, &c)
+		}
+	}
+	sort.SliceStable(output, func(i, j int) bool {
+		return output[i].CreatedTimestamp < output[j].CreatedTimestamp
+	})
+	return output, nil
+}
+
+func (m *Memory) AddRoleToUser(ctx context.Context, role *Role, userID string, userType string) error {
+	if role == nil || role.ID == "" {
+		return fmt.Errorf("invalid role")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addRoleToUser(role.ID, userID, userType)
+	return nil
+}
+
+func (m *Memory) RemoveRoleFromUser(ctx context.Context, role *Role, userID string) error {
+	if role == nil || role.ID == "" {
+		return fmt.Errorf("invalid role")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userRoles = filter(m.userRoles, func(ur *UserRole) bool {
+		return !(ur.UserID == userID && ur.RoleID == role.ID)
+	})
+	return nil
+}
+
+func (m *Memory) ReplaceRoleInUser(ctx context.Context, role *Role, userID string) (*ReplaceResult, error) {
+	if role == nil || role.ID == "" {
+		return nil, fmt.Errorf("invalid role")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userType := ""
+	var current []string
+	m.userRoles = filter(m.userRoles, func(ur *UserRole) bool {
+		if ur.UserID != userID {
+			return true
+		}
+		current = append(current, ur.RoleID)
+		if ur.RoleID == role.ID || userType == "" {
+			userType = ur.UserType
+		}
+		return false
+	})
+	m.addRoleToUser(role.ID, userID, userType)
+	return diffIDs(current, []string{role.ID}), nil
+}
+
+func (m *Memory) AddRoleToGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error {
+	if group == nil || group.ID == "" {
+		return fmt.Errorf("invalid group")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, role := range roles {
+		m.addRoleToGroup(group.ID, role.ID)
+	}
+	return nil
+}
+
+func (m *Memory) RemoveRoleFromGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error {
+	if group == nil || group.ID == "" {
+		return fmt.Errorf("invalid group")
+	}
+	roleIDs := roleIDSet(roles...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rolesInGroup = filter(m.rolesInGroup, func(rig *RolesInGroup) bool {
+		return !(rig.GroupID == group.ID && roleIDs[rig.RoleID])
+	})
+	return nil
+}
+
+func (m *Memory) ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) (*ReplaceResult, error) {
+	if group == nil || group.ID == "" {
+		return nil, fmt.Errorf("invalid group")
+	}
+	desired := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if role == nil || role.ID == "" {
+			return nil, fmt.Errorf("invalid role")
+		}
+		desired = append(desired, role.ID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var current []string
+	m.rolesInGroup = filter(m.rolesInGroup, func(rig *RolesInGroup) bool {
+		if rig.GroupID != group.ID {
+			return true
+		}
+		current = append(current, rig.RoleID)
+		return false
+	})
+	for _, id := range desired {
+		m.addRoleToGroup(group.ID, id)
+	}
+	return diffIDs(current, desired), nil
+}
+
+func (m *Memory) GetRole(ctx context.Context, roleID string) (*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	role, found := m.roles[roleID]
+	if !found {
+		return nil, fmt.Errorf("no role found with id (%s)", roleID)
+	}
+	return copyRole(role), nil
+}
+
+func (m *Memory) GetRoleWithName(ctx context.Context, name string) (*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	role := m.roleWithName(name)
+	if role == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyRole(role), nil
+}
+
+func (m *Memory) GetGroup(ctx context.Context, groupID string) (*RoleGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	group, found := m.groups[groupID]
+	if !found {
+		return nil, fmt.Errorf("no group found with id (%s)", groupID)
+	}
+	return copyGroup(group), nil
+}
+
+func (m *Memory) GetGroupWithName(ctx context.Context, name string) (*RoleGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	group := m.groupWithName(name)
+	if group == nil {
+		return nil, fmt.Errorf("no group found with name (%s)", name)
+	}
+	return copyGroup(group), nil
+}
+
+func (m *Memory) GetResource(ctx context.Context, resourceID string) (*Resource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	resource, found := m.resources[resourceID]
+	if !found {
+		return nil, fmt.Errorf("no resources found with id (%s)", resourceID)
+	}
+	return copyResource(resource), nil
+}
+
+func (m *Memory) GetResourcesWithPattern(ctx context.Context, resourcePattern string) ([]*Resource, error) {
+	exp, err := regexp.Compile(resourcePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource pattern(%s): %w", resourcePattern, err)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*Resource
+	for _, resource := range m.resources {
+		if exp.MatchString(resource.ID) {
+			output = append(output, copyResource(resource))
+		}
+	}
+	sortResources(output)
+	return output, nil
+}
+
+func (m *Memory) GetAllRoles(ctx context.Context) ([]*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*Role
+	for _, role := range m.roles {
+		output = append(output, copyRole(role))
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].ID < output[j].ID
+	})
+	return output, nil
+}
+
+func (m *Memory) GetAllGroups(ctx context.Context) ([]*RoleGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*RoleGroup
+	for _, group := range m.groups {
+		output = append(output, copyGroup(group))
+	}
+	sortGroups(output)
+	return output, nil
+}
+
+func (m *Memory) GetAllResources(ctx context.Context) ([]*Resource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*Resource
+	for _, resource := range m.resources {
+		output = append(output, copyResource(resource))
+	}
+	sortResources(output)
+	return output, nil
+}
+
+func (m *Memory) GetAllResourcesForUser(ctx context.Context, userID, accountId string) ([]*Resource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.resourcesForRoles(m.allRolesForUser(userID, accountId)...), nil
+}
+
+func (m *Memory) GetAllGroupsForUser(ctx context.Context, userID string) ([]*RoleGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.groupsForUser(userID), nil
+}
+
+func (m *Memory) GetRolesInGroup(ctx context.Context, group ...*RoleGroup) ([]*Role, error) {
+	var groupIDs []string
+	for _, g := range group {
+		groupIDs = append(groupIDs, g.ID)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rolesInGroups(groupIDs...), nil
+}
+
+func (m *Memory) GetAllRolesForUser(ctx context.Context, userID string, accountID string) ([]*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.allRolesForUser(userID, accountID), nil
+}
+
+func (m *Memory) UserHasRole(ctx context.Context, userID string, role *Role) (bool, error) {
+	if role == nil {
+		return false, fmt.Errorf("invalid role")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.userAndGroupRoles(userID) {
+		if r.ID == role.ID {
+			return true, nil
+		}
+	}
+	for _, aur := range m.accountUserRoles {
+		if aur.UserID == userID && aur.RoleID == role.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) UserHasAllRoles(ctx context.Context, userID string, roles ...*Role) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if containsAllRoles(m.userAndGroupRoles(userID), roles) {
+		return true, nil
+	}
+	for _, accountID := range m.accountsForUser(userID) {
+		if containsAllRoles(m.accountRoles(accountID, userID), roles) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) UserHasAnyRoles(ctx context.Context, userID, accountID string, roles ...*Role) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, userRole := range m.allRolesForUser(userID, accountID) {
+		for _, role := range roles {
+			if strings.EqualFold(userRole.ID, role.ID) {
+				return true, nil
+			}
+			if strings.EqualFold(userRole.Name, role.Name) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) GetRoleResourcePermissions(ctx context.Context, roles ...*Role) ([]*RoleResourcePermissions, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*RoleResourcePermissions
+	for _, rrp := range m.permissionsForRoles(roles...) {
+		c := *rrp
+		output = append(output, &c)
+	}
+	return output, nil
+}
+
+func (m *Memory) GetResourcesForRole(ctx context.Context, roles ...*Role) ([]*Resource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.resourcesForRoles(roles...), nil
+}
+
+func (m *Memory) RoleHasPermission(ctx context.Context, role *Role, resource *Resource, access ...int) (bool, error) {
+	if role == nil || resource == nil {
+		return false, fmt.Errorf("invalid role or resource")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := matchingPermissionsForResources(m.permissionsForRoles(role), resource)
+	if len(rows) == 0 {
+		return false, fmt.Errorf("role does not have permissions to view this resource (%s)", fmt.Sprintf("%s$", resource.ID))
+	}
+	return rowsHaveAccess(rows, CombineAccess(access...)), nil
+}
+
+func (m *Memory) RoleHasAnyPermission(ctx context.Context, role *Role, resources []*Resource, access ...int) (bool, error) {
+	if role == nil {
+		return false, fmt.Errorf("invalid role")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := matchingPermissionsForResources(m.permissionsForRoles(role), resources...)
+	return rowsHaveAccess(rows, CombineAccess(access...)), nil
+}
+
+func (m *Memory) RoleHasAllPermissions(ctx context.Context, role *Role, resources []*Resource, access ...int) (bool, error) {
+	if role == nil {
+		return false, fmt.Errorf("invalid role")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return rowsHaveAllAccess(m.permissionsForRoles(role), resources, CombineAccess(access...)), nil
+}
+
+func (m *Memory) UserHasPermissionForResource(ctx context.Context, userID, accountID string, resource *Resource, access ...int) (bool, error) {
+	if resource == nil {
+		return false, fmt.Errorf("invalid resource")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := matchingPermissionsForResources(m.permissionsForRoles(m.allRolesForUser(userID, accountID)...), resource)
+	if len(rows) == 0 {
+		return false, nil
+	}
+	if rowsHaveAccess(rows, CombineAccess(access...)) {
+		return true, nil
+	}
+	return false, ErrAccessDenied
+}
+
+func (m *Memory) UserHasAnyPermissionForResource(ctx context.Context, userID, accountID string, resources []*Resource, access ...int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := matchingPermissionsForResources(m.permissionsForRoles(m.allRolesForUser(userID, accountID)...), resources...)
+	return rowsHaveAccess(rows, CombineAccess(access...)), nil
+}
+
+func (m *Memory) AddPermissionResourceToRole(ctx context.Context, role *Role, resource *Resource, access ...int) error {
+	if role == nil || resource == nil {
+		return fmt.Errorf("invalid role or resource")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addPermission(role.ID, resource.ID, CombineAccess(access...))
+	return nil
+}
+
+func (m *Memory) RemovePermissionsFromRole(ctx context.Context, role *Role, resources ...*Resource) error {
+	if role == nil {
+		return fmt.Errorf("invalid role")
+	}
+	resourceIDs := map[string]bool{}
+	for _, resource := range resources {
+		resourceIDs[resource.ID] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.permissions = filter(m.permissions, func(rrp *RoleResourcePermissions) bool {
+		return !(rrp.RoleID == role.ID && resourceIDs[rrp.ResourceID])
+	})
+	return nil
+}
+
+func (m *Memory) ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) (*ReplaceResult, error) {
+	if role == nil || resource == nil {
+		return nil, fmt.Errorf("invalid role or resource")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var current []string
+	m.permissions = filter(m.permissions, func(rrp *RoleResourcePermissions) bool {
+		if rrp.RoleID == role.ID && rrp.ResourceID == resource.ID {
+			current = append(current, strconv.Itoa(rrp.Access))
+			return false
+		}
+		return true
+	})
+	combined := CombineAccess(access...)
+	m.addPermission(role.ID, resource.ID, combined)
+	return diffIDs(current, []string{strconv.Itoa(combined)}), nil
+}
+
+func (m *Memory) NewAccountUserRole(ctx context.Context, accountID string, roleID string, userID string) (*AccountUserRole, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID && aur.UserID == userID && aur.RoleID == roleID {
+			aur.UpdatedTimestamp = memoryTimestamp()
+			c := *aur
+			return &c, nil
+		}
+	}
+	ts := memoryTimestamp()
+	aur := &AccountUserRole{
+		AccountID:        accountID,
+		UserID:           userID,
+		RoleID:           roleID,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	}
+	m.accountUserRoles = append(m.accountUserRoles, aur)
+	c := *aur
+	return &c, nil
+}
+
+func (m *Memory) DeleteAccountUserRole(ctx context.Context, accountID string, roleID string, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accountUserRoles = filter(m.accountUserRoles, func(aur *AccountUserRole) bool {
+		return !(aur.AccountID == accountID && aur.UserID == userID && aur.RoleID == roleID)
+	})
+	return nil
+}
+
+func (m *Memory) GetAccountUserRoles(ctx context.Context, accountID string, userID string) ([]*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.accountUserRoleRows(accountID, userID), nil
+}
+
+func (m *Memory) GetAllAccountUserRoles(ctx context.Context, accountID string) ([]*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var roleIDs []string
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID {
+			roleIDs = append(roleIDs, aur.RoleID)
+		}
+	}
+	var groupIDs []string
+	for _, aug := range m.accountUserGroups {
+		if aug.AccountID == accountID {
+			groupIDs = append(groupIDs, aug.GroupID)
+		}
+	}
+	for _, role := range m.rolesInGroups(groupIDs...) {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return m.rolesWithIDs(roleIDs...), nil
+}
+
+func (m *Memory) NewAccountUserGroup(ctx context.Context, accountID string, groupID string, userID string) (*AccountUserGroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, aug := range m.accountUserGroups {
+		if aug.AccountID == accountID && aug.UserID == userID && aug.GroupID == groupID {
+			return nil, fmt.Errorf("account user group already exists")
+		}
+	}
+	ts := memoryTimestamp()
+	aug := &AccountUserGroup{
+		AccountID:        accountID,
+		UserID:           userID,
+		GroupID:          groupID,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	}
+	m.accountUserGroups = append(m.accountUserGroups, aug)
+	c := *aug
+	return &c, nil
+}
+
+func (m *Memory) DeleteAccountUserGroup(ctx context.Context, accountID string, groupID string, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accountUserGroups = filter(m.accountUserGroups, func(aug *AccountUserGroup) bool {
+		return !(aug.AccountID == accountID && aug.UserID == userID && aug.GroupID == groupID)
+	})
+	return nil
+}
+
+func (m *Memory) GetAccountUserGroup(ctx context.Context, accountID string, userID string) ([]*AccountUserGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*AccountUserGroup
+	for _, aug := range m.accountUserGroups {
+		if aug.AccountID == accountID && aug.UserID == userID {
+			c := *aug
+			output = append(output, &c)
+		}
+	}
+	return output, nil
+}
+
+func (m *Memory) GetAllAccountGroups(ctx context.Context, accountID string) ([]*AccountUserGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*AccountUserGroup
+	for _, aug := range m.accountUserGroups {
+		if aug.AccountID == accountID {
+			c := *aug
+			output = append(output, &c)
+		}
+	}
+	return output, nil
+}
+
+func (m *Memory) AccountUserHasRole(ctx context.Context, accountID, userID string, role *Role) (bool, error) {
+	if role == nil {
+		return false, fmt.Errorf("invalid role")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID && aur.UserID == userID && aur.RoleID == role.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) AccountUserHasAllRoles(ctx context.Context, accountID, userID string, roles ...*Role) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return containsAllRoles(m.accountRoles(accountID, userID), roles), nil
+}
+
+func (m *Memory) AccountUserHasAnyRoles(ctx context.Context, accountID, userID string, roles ...*Role) (bool, error) {
+	roleIDs := roleIDSet(roles...)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID && aur.UserID == userID && roleIDs[aur.RoleID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) AccountUserHasPermissionForResource(ctx context.Context, accountID, userID string, resource *Resource, access ...int) (bool, error) {
+	if resource == nil {
+		return false, fmt.Errorf("invalid resource")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := matchingPermissionsForResources(m.permissionsForRoles(m.accountUserRoleRows(accountID, userID)...), resource)
+	if len(rows) == 0 {
+		return false, nil
+	}
+	if rowsHaveAccess(rows, CombineAccess(access...)) {
+		return true, nil
+	}
+	return false, ErrAccessDenied
+}
+
+func (m *Memory) AccountUserHasAnyPermissionForResource(ctx context.Context, accountID, userID string, resources []*Resource, access ...int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := matchingPermissionsForResources(m.permissionsForRoles(m.accountUserRoleRows(accountID, userID)...), resources...)
+	return rowsHaveAccess(rows, CombineAccess(access...)), nil
+}
+
+func (m *Memory) GetAccountsForUser(ctx context.Context, userID string) ([]*AccountUserRole, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*AccountUserRole
+	for _, aur := range m.accountUserRoles {
+		if aur.UserID == userID {
+			c := *aur
+			output = append(output, &c)
+		}
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("no accounts found for user ID %s", userID)
+	}
+	return output, nil
+}
+
+func (m *Memory) GetAllAccountUsers(ctx context.Context, accountID string) ([]*AccountUserRole, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var output []*AccountUserRole
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID {
+			c := *aur
+			output = append(output, &c)
+		}
+	}
+	return output, nil
+}
+
+// the helpers below expect the caller to hold m.mu
+
+func (m *Memory) groupWithName(name string) *RoleGroup {
+	for _, group := range m.groups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+func (m *Memory) roleWithName(name string) *Role {
+	for _, role := range m.roles {
+		if role.Name == name {
+			return role
+		}
+	}
+	return nil
+}
+
+func (m *Memory) addGroupToUser(groupID, userID, userType string) {
+	for _, ug := range m.userGroups {
+		if ug.UserID == userID && ug.GroupID == groupID {
+			return
+		}
+	}
+	ts := memoryTimestamp()
+	m.userGroups = append(m.userGroups, &UserGroup{
+		GroupID:          groupID,
+		UserID:           userID,
+		UserType:         userType,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	})
+}
+
+func (m *Memory) addRoleToUser(roleID, userID, userType string) {
+	for _, ur := range m.userRoles {
+		if ur.UserID == userID && ur.RoleID == roleID {
+			return
+		}
+	}
+	ts := memoryTimestamp()
+	m.userRoles = append(m.userRoles, &UserRole{
+		RoleID:           roleID,
+		UserID:           userID,
+		UserType:         userType,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	})
+}
+
+func (m *Memory) addRoleToGroup(groupID, roleID string) {
+	for _, rig := range m.rolesInGroup {
+		if rig.GroupID == groupID && rig.RoleID == roleID {
+			return
+		}
+	}
+	ts := memoryTimestamp()
+	m.rolesInGroup = append(m.rolesInGroup, &RolesInGroup{
+		GroupID:          groupID,
+		RoleID:           roleID,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	})
+}
+
+func (m *Memory) addPermission(roleID, resourceID string, access int) {
+	for _, rrp := range m.permissions {
+		if rrp.RoleID == roleID && rrp.ResourceID == resourceID && rrp.Access == access {
+			rrp.UpdatedTimestamp = memoryTimestamp()
+			return
+		}
+	}
+	ts := memoryTimestamp()
+	m.permissions = append(m.permissions, &RoleResourcePermissions{
+		RoleID:           roleID,
+		ResourcePattern:  resourceID,
+		ResourceID:       resourceID,
+		Access:           access,
+		UpdatedTimestamp: ts,
+		CreatedTimestamp: ts,
+	})
+}
+
+func (m *Memory) groupsForUser(userID string) []*RoleGroup {
+	var output []*RoleGroup
+	for _, ug := range m.userGroups {
+		if ug.UserID != userID {
+			continue
+		}
+		if group, found := m.groups[ug.GroupID]; found {
+			output = append(output, copyGroup(group))
+		}
+	}
+	sortGroups(output)
+	return output
+}
+
+func (m *Memory) rolesWithIDs(roleIDs ...string) []*Role {
+	seen := map[string]bool{}
+	var output []*Role
+	for _, id := range roleIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if role, found := m.roles[id]; found {
+			output = append(output, copyRole(role))
+		}
+	}
+	sort.SliceStable(output, func(i, j int) bool {
+		return output[i].Priority < output[j].Priority
+	})
+	return output
+}
+
+func (m *Memory) rolesInGroups(groupIDs ...string) []*Role {
+	groups := map[string]bool{}
+	for _, id := range groupIDs {
+		groups[id] = true
+	}
+	var roleIDs []string
+	for _, rig := range m.rolesInGroup {
+		if groups[rig.GroupID] {
+			roleIDs = append(roleIDs, rig.RoleID)
+		}
+	}
+	return m.rolesWithIDs(roleIDs...)
+}
+
+// userAndGroupRoles returns the roles assigned directly to the user and through their groups.
+func (m *Memory) userAndGroupRoles(userID string) []*Role {
+	var roleIDs []string
+	for _, ur := range m.userRoles {
+		if ur.UserID == userID {
+			roleIDs = append(roleIDs, ur.RoleID)
+		}
+	}
+	var groupIDs []string
+	for _, group := range m.groupsForUser(userID) {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	for _, role := range m.rolesInGroups(groupIDs...) {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return m.rolesWithIDs(roleIDs...)
+}
+
+// accountRoles returns the roles assigned to a user inside an account without its group roles,
+// like Impl.AccountUserHasAllRoles.
+func (m *Memory) accountRoles(accountID, userID string) []*Role {
+	var roles []*Role
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID && aur.UserID == userID {
+			roles = append(roles, &Role{ID: aur.RoleID})
+		}
+	}
+	return roles
+}
+
+// accountUserRoleRows returns the roles a user has inside an account, including account group roles.
+func (m *Memory) accountUserRoleRows(accountID, userID string) []*Role {
+	var roleIDs []string
+	for _, aur := range m.accountUserRoles {
+		if aur.AccountID == accountID && aur.UserID == userID {
+			roleIDs = append(roleIDs, aur.RoleID)
+		}
+	}
+	var groupIDs []string
+	for _, aug := range m.accountUserGroups {
+		if aug.AccountID == accountID && aug.UserID == userID {
+			groupIDs = append(groupIDs, aug.GroupID)
+		}
+	}
+	for _, role := range m.rolesInGroups(groupIDs...) {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	return m.rolesWithIDs(roleIDs...)
+}
+
+func (m *Memory) accountsForUser(userID string) []string {
+	seen := map[string]bool{}
+	var output []string
+	for _, aur := range m.accountUserRoles {
+		if aur.UserID == userID && !seen[aur.AccountID] {
+			seen[aur.AccountID] = true
+			output = append(output, aur.AccountID)
+		}
+	}
+	return output
+}
+
+func (m *Memory) allRolesForUser(userID, accountID string) []*Role {
+	roles := m.userAndGroupRoles(userID)
+	roles = append(roles, m.accountUserRoleRows(accountID, userID)...)
+	if accountID != "" {
+		roles = append(roles, m.allRolesForUser(accountID, "")...)
+	}
+	return removeDuplicateRoles(roles)
+}
+
+func (m *Memory) permissionsForRoles(roles ...*Role) []*RoleResourcePermissions {
+	roleIDs := roleIDSet(roles...)
+	var output []*RoleResourcePermissions
+	for _, rrp := range m.permissions {
+		if roleIDs[rrp.RoleID] {
+			output = append(output, rrp)
+		}
+	}
+	return output
+}
+
+func (m *Memory) resourcesForRoles(roles ...*Role) []*Resource {
+	seen := map[string]bool{}
+	var output []*Resource
+	for _, rrp := range m.permissionsForRoles(roles...) {
+		if seen[rrp.ResourceID] {
+			continue
+		}
+		seen[rrp.ResourceID] = true
+		if resource, found := m.resources[rrp.ResourceID]; found {
+			output = append(output, copyResource(resource))
+		}
+	}
+	sortResources(output)
+	return output
+}
+
+func rowsHaveAccess(rows []*RoleResourcePermissions, access int) bool {
+	for _, row := range rows {
+		if HasAccess(row.Access, access) {
+			return true
+		}
+	}
+	return false
+}
+
+// rowsHaveAllAccess reports whether rows grant access to every resource, no resources grant nothing.
+func rowsHaveAllAccess(rows []*RoleResourcePermissions, resources []*Resource, access int) bool {
+	for _, resource := range resources {
+		if !rowsHaveAccess(matchingPermissionsForResources(rows, resource), access) {
+			return false
+		}
+	}
+	return len(resources) > 0
+}
+
+func containsAllRoles(userRoles []*Role, roles []*Role) bool {
+	if len(roles) == 0 {
+		return false
+	}
+	found := roleIDSet(userRoles...)
+	for _, role := range roles {
+		if !found[role.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+func roleIDSet(roles ...*Role) map[string]bool {
+	output := map[string]bool{}
+	for _, role := range roles {
+		if role != nil {
+			output[role.ID] = true
+		}
+	}
+	return output
+}
+
+func filter[T any](list []T, keep func(T) bool) []T {
+	output := list[:0]
+	for _, item := range list {
+		if keep(item) {
+			output = append(output, item)
+		}
+	}
+	return output
+}
+
+func sortGroups(groups []*RoleGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+}
+
+func sortResources(resources []*Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ID < resources[j].ID
+	})
+}
+
+func copyGroup(group *RoleGroup) *RoleGroup {
+	c := *group
+	return &c
+}
+
+func copyRole(role *Role) *Role {
+	c := *role
+	return &c
+}
+
+func copyResource(resource *Resource) *Resource {
+	c := *resource
+	return &c
+}
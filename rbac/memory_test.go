@@ -0,0 +1,294 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Seann-Moser/cutil/sqlc/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRolesAndGroups(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	admin, err := m.NewRole(ctx, "admin", "", 10)
+	require.NoError(t, err)
+	viewer, err := m.NewRole(ctx, "viewer", "", 1)
+	require.NoError(t, err)
+
+	again, err := m.NewRole(ctx, "admin", "ignored", 0)
+	require.NoError(t, err)
+	assert.Equal(t, admin.ID, again.ID)
+
+	group, err := m.NewGroup(ctx, "staff", "")
+	require.NoError(t, err)
+	require.NoError(t, m.AddRoleToGroup(ctx, group, viewer))
+	require.NoError(t, m.AddGroupToUser(ctx, group, "user-1", "member"))
+	require.NoError(t, m.AddRoleToUser(ctx, admin, "user-2", "member"))
+
+	hasRole, err := m.UserHasRole(ctx, "user-1", viewer)
+	require.NoError(t, err)
+	assert.True(t, hasRole)
+
+	hasRole, err = m.UserHasRole(ctx, "user-1", admin)
+	require.NoError(t, err)
+	assert.False(t, hasRole)
+
+	roles, err := m.GetAllRolesForUser(ctx, "user-2", "")
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, admin.ID, roles[0].ID)
+
+	require.NoError(t, m.RemoveRoleFromGroup(ctx, group, viewer))
+	hasRole, err = m.UserHasRole(ctx, "user-1", viewer)
+	require.NoError(t, err)
+	assert.False(t, hasRole)
+
+	_, err = m.GetRoleWithName(ctx, "missing")
+	assert.Error(t, err)
+}
+
+func TestMemoryAccountRoles(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	owner, _ := m.NewRole(ctx, "owner", "", 5)
+	billing, _ := m.NewRole(ctx, "billing", "", 1)
+	group, _ := m.NewGroup(ctx, "finance", "")
+	require.NoError(t, m.AddRoleToGroup(ctx, group, billing))
+
+	_, err := m.NewAccountUserRole(ctx, "acc-1", owner.ID, "user-1")
+	require.NoError(t, err)
+	_, err = m.NewAccountUserGroup(ctx, "acc-1", group.ID, "user-2")
+	require.NoError(t, err)
+
+	roles, err := m.GetAccountUserRoles(ctx, "acc-1", "user-2")
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, billing.ID, roles[0].ID)
+
+	roles, err = m.GetAllAccountUserRoles(ctx, "acc-1")
+	require.NoError(t, err)
+	assert.Len(t, roles, 2)
+
+	hasRole, err := m.AccountUserHasRole(ctx, "acc-1", "user-1", owner)
+	require.NoError(t, err)
+	assert.True(t, hasRole)
+
+	hasRole, err = m.UserHasAnyRoles(ctx, "user-1", "acc-1", owner)
+	require.NoError(t, err)
+	assert.True(t, hasRole)
+
+	_, err = m.GetAccountsForUser(ctx, "user-3")
+	assert.Error(t, err)
+
+	require.NoError(t, m.DeleteAccountUserRole(ctx, "acc-1", owner.ID, "user-1"))
+	hasRole, err = m.AccountUserHasRole(ctx, "acc-1", "user-1", owner)
+	require.NoError(t, err)
+	assert.False(t, hasRole)
+}
+
+func TestMemoryPermissions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	editor, _ := m.NewRole(ctx, "editor", "", 1)
+	resource, err := m.NewResource(ctx, "API.v1.items", "", "endpoint", "", true)
+	require.NoError(t, err)
+	assert.Equal(t, "api.v1.items", resource.ID)
+
+	_, err = m.NewResource(ctx, "a", "", "endpoint", "", true)
+	assert.Error(t, err)
+
+	require.NoError(t, m.AddPermissionResourceToRole(ctx, editor, resource, AccessRead, AccessWrite))
+	require.NoError(t, m.AddRoleToUser(ctx, editor, "user-1", ""))
+
+	tests := []struct {
+		access  int
+		want    bool
+		wantErr bool
+	}{
+		{AccessRead, true, false},
+		{AccessWrite, true, false},
+		{AccessDelete, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("access_%d", tt.access), func(t *testing.T) {
+			got, err := m.UserHasPermissionForResource(ctx, "user-1", "", resource, tt.access)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	got, err := m.UserHasPermissionForResource(ctx, "user-2", "", resource, AccessRead)
+	assert.NoError(t, err)
+	assert.False(t, got)
+
+	result, err := m.ReplacePermissionsInRole(ctx, editor, resource, AccessDelete)
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaceResult{Added: []string{"8"}, Removed: []string{"3"}}, result)
+	got, err = m.RoleHasPermission(ctx, editor, resource, AccessRead)
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	resources, err := m.GetAllResourcesForUser(ctx, "user-1", "")
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+
+	require.NoError(t, m.RemovePermissionsFromRole(ctx, editor, resource))
+	_, err = m.RoleHasPermission(ctx, editor, resource, AccessRead)
+	assert.Error(t, err)
+}
+
+func TestMemoryConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	role, _ := m.NewRole(ctx, "reader", "", 1)
+	resource, _ := m.NewResource(ctx, "api.v1.items", "", "endpoint", "", true)
+	require.NoError(t, m.AddPermissionResourceToRole(ctx, role, resource, AccessRead))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user-%d", i)
+			_ = m.AddRoleToUser(ctx, role, userID, "")
+			_, _ = m.UserHasPermissionForResource(ctx, userID, "", resource, AccessRead)
+			_ = m.RemoveRoleFromUser(ctx, role, userID)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMemoryReplace(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	viewer, _ := m.NewRole(ctx, "viewer", "", 1)
+	editor, _ := m.NewRole(ctx, "editor", "", 2)
+	admin, _ := m.NewRole(ctx, "admin", "", 3)
+	staff, _ := m.NewGroup(ctx, "staff", "")
+	ops, _ := m.NewGroup(ctx, "ops", "")
+
+	require.NoError(t, m.AddRoleToGroup(ctx, staff, viewer, editor))
+	result, err := m.ReplaceRoleInGroup(ctx, staff, editor, admin)
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaceResult{Added: []string{admin.ID}, Removed: []string{viewer.ID}}, result)
+	roles, err := m.GetRolesInGroup(ctx, staff)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{editor.ID, admin.ID}, []string{roles[0].ID, roles[1].ID})
+
+	result, err = m.ReplaceRoleInGroup(ctx, staff)
+	require.NoError(t, err)
+	assert.Len(t, result.Removed, 2)
+
+	require.NoError(t, m.AddGroupToUser(ctx, staff, "user-1", "member"))
+	result, err = m.ReplaceGroupInUser(ctx, ops, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaceResult{Added: []string{ops.ID}, Removed: []string{staff.ID}}, result)
+	members, err := m.GetUserGroupWithType(ctx, "user-1", "member")
+	require.NoError(t, err)
+	require.Len(t, members, 1, "the user type is carried over")
+	assert.Equal(t, ops.ID, members[0].GroupID)
+
+	require.NoError(t, m.AddRoleToUser(ctx, viewer, "user-1", "member"))
+	require.NoError(t, m.AddRoleToUser(ctx, editor, "user-1", "member"))
+	result, err = m.ReplaceRoleInUser(ctx, viewer, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaceResult{Added: []string{}, Removed: []string{editor.ID}}, result)
+	has, err := m.UserHasRole(ctx, "user-1", editor)
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	_, err = m.ReplaceRoleInGroup(ctx, staff, nil)
+	assert.Error(t, err)
+}
+
+// TestAllRolesAndPermissions runs the *All* checks against Memory and against Impl on a fake
+// database holding the same rows.
+func TestAllRolesAndPermissions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	viewer, _ := m.NewRole(ctx, "viewer", "", 1)
+	editor, _ := m.NewRole(ctx, "editor", "", 2)
+	admin, _ := m.NewRole(ctx, "admin", "", 3)
+	billing, _ := m.NewRole(ctx, "billing", "", 1)
+	staff, _ := m.NewGroup(ctx, "staff", "")
+	require.NoError(t, m.AddRoleToUser(ctx, viewer, "user-1", "member"))
+	require.NoError(t, m.AddRoleToGroup(ctx, staff, editor))
+	require.NoError(t, m.AddGroupToUser(ctx, staff, "user-1", "member"))
+	_, err := m.NewAccountUserRole(ctx, "acc-1", admin.ID, "user-1")
+	require.NoError(t, err)
+	_, err = m.NewAccountUserRole(ctx, "acc-1", billing.ID, "user-1")
+	require.NoError(t, err)
+	items, users, orders := &Resource{ID: "items"}, &Resource{ID: "users"}, &Resource{ID: "orders"}
+	require.NoError(t, m.AddPermissionResourceToRole(ctx, viewer, items, AccessRead))
+	require.NoError(t, m.AddPermissionResourceToRole(ctx, viewer, users, AccessRead, AccessWrite))
+
+	fake := newFakeDB(&fakeConn{tables: map[string]*fakeTable{
+		"rbac.user_role":                 fakeTableOf(m.userRoles...),
+		"rbac.user_group":                fakeTableOf(m.userGroups...),
+		"rbac.roles_in_group":            fakeTableOf(m.rolesInGroup...),
+		"rbac.account_user_role":         fakeTableOf(m.accountUserRoles...),
+		"rbac.role_resource_permissions": fakeTableOf(m.permissions...),
+	}})
+	ctx, err = orm.AddTableCtx[UserRole](ctx, fake, queryDatabase, queryType)
+	require.NoError(t, err)
+	ctx, err = orm.AddTableCtx[UserGroup](ctx, fake, queryDatabase, queryType)
+	require.NoError(t, err)
+	ctx, err = orm.AddTableCtx[RolesInGroup](ctx, fake, queryDatabase, queryType)
+	require.NoError(t, err)
+	ctx, err = orm.AddTableCtx[AccountUserRole](ctx, fake, queryDatabase, queryType)
+	require.NoError(t, err)
+	ctx, err = orm.AddTableCtx[RoleResourcePermissions](ctx, fake, queryDatabase, queryType)
+	require.NoError(t, err)
+
+	roleTests := []struct {
+		name  string
+		roles []*Role
+		want  bool
+	}{
+		{"direct role", []*Role{viewer}, true},
+		{"direct and group roles", []*Role{viewer, editor}, true},
+		{"account roles", []*Role{admin, billing}, true},
+		{"roles split across user and account", []*Role{viewer, admin}, false},
+		{"one missing role", []*Role{viewer, {ID: "missing"}}, false},
+		{"no roles", nil, false},
+	}
+	permissionTests := []struct {
+		name      string
+		resources []*Resource
+		access    int
+		want      bool
+	}{
+		{"single resource", []*Resource{items}, AccessRead, true},
+		{"every resource", []*Resource{items, users}, AccessRead, true},
+		{"one resource without permission", []*Resource{items, orders}, AccessRead, false},
+		{"one resource without access", []*Resource{items, users}, AccessWrite, false},
+		{"no resources", nil, AccessRead, false},
+	}
+	for name, backend := range map[string]RBAC{"memory": m, "impl": New()} {
+		for _, tt := range roleTests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				got, err := backend.UserHasAllRoles(ctx, "user-1", tt.roles...)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			})
+		}
+		for _, tt := range permissionTests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				got, err := backend.RoleHasAllPermissions(ctx, viewer, tt.resources, tt.access)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			})
+		}
+	}
+}
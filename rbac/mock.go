@@ -153,8 +153,8 @@ func (m Mock) RemoveGroupFromUser(ctx context.Context, group *RoleGroup, userID
 	return nil
 }
 
-func (m Mock) ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) error {
-	return nil
+func (m Mock) ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) (*ReplaceResult, error) {
+	return &ReplaceResult{}, nil
 }
 
 func (m Mock) AddRoleToUser(ctx context.Context, role *Role, userID string, userType string) error {
@@ -165,8 +165,8 @@ func (m Mock) RemoveRoleFromUser(ctx context.Context, role *Role, userID string)
 	return nil
 }
 
-func (m Mock) ReplaceRoleInUser(ctx context.Context, role *Role, userID string) error {
-	return nil
+func (m Mock) ReplaceRoleInUser(ctx context.Context, role *Role, userID string) (*ReplaceResult, error) {
+	return &ReplaceResult{}, nil
 }
 
 func (m Mock) AddPermissionResourceToRole(ctx context.Context, role *Role, resource *Resource, access ...int) error {
@@ -177,8 +177,8 @@ func (m Mock) RemovePermissionsFromRole(ctx context.Context, role *Role, resourc
 	return nil
 }
 
-func (m Mock) ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) error {
-	return nil
+func (m Mock) ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) (*ReplaceResult, error) {
+	return &ReplaceResult{}, nil
 }
 
 func (m Mock) AddRoleToGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error {
@@ -189,8 +189,8 @@ func (m Mock) RemoveRoleFromGroup(ctx context.Context, group *RoleGroup, roles .
 	return nil
 }
 
-func (m Mock) ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error {
-	return nil
+func (m Mock) ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) (*ReplaceResult, error) {
+	return &ReplaceResult{}, nil
 }
 
 func (m Mock) GetRole(ctx context.Context, roleID string) (*Role, error) {
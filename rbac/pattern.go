@@ -0,0 +1,150 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+)
+
+// validResourceNamePattern accepts dot separated segments made of [a-z0-9_-{}] or a single "*" wildcard.
+const validResourceNamePattern = `^(([a-z0-9_\-{}]{2,}|\*)\.*)+$`
+
+// MatchResourcePattern reports whether resourceID is covered by pattern.
+// Both are split into "." separated segments. A "{name}" or "*" segment matches exactly one segment,
+// and a trailing "*" matches one or more remaining segments ("api.v1.*" covers "api.v1.users.{id}").
+// Leading and trailing dots are ignored, so ".api.v1.users" and "api.v1.users" are equivalent.
+func MatchResourcePattern(pattern, resourceID string) bool {
+	p := splitResourceID(pattern)
+	r := splitResourceID(resourceID)
+	if len(p) == 0 {
+		return len(r) == 0
+	}
+	for i, segment := range p {
+		if i >= len(r) {
+			return false
+		}
+		if segment == "*" && i == len(p)-1 {
+			return true
+		}
+		if segment == "*" || isVarSegment(segment) {
+			continue
+		}
+		if segment != r[i] {
+			return false
+		}
+	}
+	return len(p) == len(r)
+}
+
+// ComparePatternSpecificity returns a positive number when a is more specific than b for resourceID,
+// a negative number when b is more specific and 0 when they are equally specific.
+// An exact match always wins, then the pattern with more literal segments,
+// then a pattern without a trailing "*" over one with it.
+func ComparePatternSpecificity(a, b, resourceID string) int {
+	sa := newPatternSpecificity(a, resourceID)
+	sb := newPatternSpecificity(b, resourceID)
+	switch {
+	case sa.exact != sb.exact:
+		if sa.exact {
+			return 1
+		}
+		return -1
+	case sa.literals != sb.literals:
+		return sa.literals - sb.literals
+	case sa.trailingGlob != sb.trailingGlob:
+		if sb.trailingGlob {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// MatchingPermissions returns the permission rows that apply to resourceID.
+// Roles are evaluated independently: for each role only the rows with its most specific matching
+// pattern are returned, so a role granting "api.v1.*" read/write and "api.v1.users" read
+// only has read access to "api.v1.users". Rows are returned sorted by role id.
+func MatchingPermissions(rows []*RoleResourcePermissions, resourceID string) []*RoleResourcePermissions {
+	best := map[string][]*RoleResourcePermissions{}
+	for _, row := range rows {
+		pattern := row.pattern()
+		if !MatchResourcePattern(pattern, resourceID) {
+			continue
+		}
+		current, found := best[row.RoleID]
+		if !found {
+			best[row.RoleID] = []*RoleResourcePermissions{row}
+			continue
+		}
+		switch cmp := ComparePatternSpecificity(pattern, current[0].pattern(), resourceID); {
+		case cmp > 0:
+			best[row.RoleID] = []*RoleResourcePermissions{row}
+		case cmp == 0:
+			best[row.RoleID] = append(current, row)
+		}
+	}
+
+	roleIDs := make([]string, 0, len(best))
+	for roleID := range best {
+		roleIDs = append(roleIDs, roleID)
+	}
+	sort.Strings(roleIDs)
+	var output []*RoleResourcePermissions
+	for _, roleID := range roleIDs {
+		output = append(output, best[roleID]...)
+	}
+	return output
+}
+
+// matchingPermissionsForResources applies MatchingPermissions for every resource and joins the results.
+func matchingPermissionsForResources(rows []*RoleResourcePermissions, resources ...*Resource) []*RoleResourcePermissions {
+	var output []*RoleResourcePermissions
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
+		output = append(output, MatchingPermissions(rows, resource.ID)...)
+	}
+	return output
+}
+
+func (rrp *RoleResourcePermissions) pattern() string {
+	if rrp.ResourcePattern != "" {
+		return rrp.ResourcePattern
+	}
+	return rrp.ResourceID
+}
+
+type patternSpecificity struct {
+	exact        bool
+	literals     int
+	trailingGlob bool
+}
+
+func newPatternSpecificity(pattern, resourceID string) patternSpecificity {
+	p := splitResourceID(pattern)
+	s := patternSpecificity{
+		exact: strings.Join(p, ".") == strings.Join(splitResourceID(resourceID), "."),
+	}
+	for i, segment := range p {
+		switch {
+		case segment == "*" && i == len(p)-1:
+			s.trailingGlob = true
+		case segment == "*" || isVarSegment(segment):
+		default:
+			s.literals++
+		}
+	}
+	return s
+}
+
+func splitResourceID(id string) []string {
+	id = strings.Trim(strings.ToLower(strings.TrimSpace(id)), ".")
+	if id == "" {
+		return nil
+	}
+	return strings.Split(id, ".")
+}
+
+func isVarSegment(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
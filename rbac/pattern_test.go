@@ -0,0 +1,119 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchResourcePattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		resourceID string
+		want       bool
+	}{
+		{"api.v1.users", "api.v1.users", true},
+		{"api.v1.users", ".api.v1.users", true},
+		{"api.v1.users", "api.v1.users.{id}", false},
+		{"api.v1.*", "api.v1.users", true},
+		{"api.v1.*", "api.v1.users.{id}.items", true},
+		{"api.v1.*", "api.v1", false},
+		{"api.*.users", "api.v1.users", true},
+		{"api.*.users", "api.v1.v2.users", false},
+		{"api.v1.{id}.items", "api.v1.123.items", true},
+		{"api.v1.{id}.items", "api.v1.{user_id}.items", true},
+		{"api.v1.{id}.items", "api.v1.123.items.456", false},
+		{"api.v1.{id}.items", "api.v1.items", false},
+		{"*", "anything.at.all", true},
+		{"", "", true},
+		{"", "api", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.resourceID, func(t *testing.T) {
+			if got := MatchResourcePattern(tt.pattern, tt.resourceID); got != tt.want {
+				t.Errorf("MatchResourcePattern(%q, %q) = %v; want %v", tt.pattern, tt.resourceID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparePatternSpecificity(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		resourceID string
+		want       int
+	}{
+		{"api.v1.users", "api.v1.*", "api.v1.users", 1},
+		{"api.v1.*", "api.*", "api.v1.users", 1},
+		{"api.*.users", "api.v1.*", "api.v1.users", 1},
+		{"api.v1.{id}", "api.v1.*", "api.v1.123", 1},
+		{"api.v1.{id}", "api.v1.{user_id}", "api.v1.123", 0},
+		{"api.v1.{id}", "api.v1.123", "api.v1.123", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			got := ComparePatternSpecificity(tt.a, tt.b, tt.resourceID)
+			switch {
+			case tt.want > 0:
+				assert.Positive(t, got)
+			case tt.want < 0:
+				assert.Negative(t, got)
+			default:
+				assert.Zero(t, got)
+			}
+		})
+	}
+}
+
+func TestMatchingPermissions(t *testing.T) {
+	rows := []*RoleResourcePermissions{
+		{RoleID: "editor", ResourcePattern: "api.v1.*", ResourceID: "api.v1.*", Access: AccessRead | AccessWrite},
+		{RoleID: "editor", ResourcePattern: "api.v1.users", ResourceID: "api.v1.users", Access: AccessRead},
+		{RoleID: "viewer", ResourcePattern: "api.*", ResourceID: "api.*", Access: AccessRead},
+		{RoleID: "viewer", ResourcePattern: "other.*", ResourceID: "other.*", Access: AccessDelete},
+	}
+
+	got := MatchingPermissions(rows, "api.v1.users")
+	require.Len(t, got, 2)
+	assert.Equal(t, "editor", got[0].RoleID)
+	assert.Equal(t, AccessRead, got[0].Access)
+	assert.Equal(t, "viewer", got[1].RoleID)
+
+	got = MatchingPermissions(rows, "api.v1.items")
+	require.Len(t, got, 2)
+	assert.Equal(t, AccessRead|AccessWrite, got[0].Access)
+
+	assert.Empty(t, MatchingPermissions(rows, "billing.invoices"))
+}
+
+func TestMemoryWildcardPermissions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	role, _ := m.NewRole(ctx, "editor", "", 1)
+	pattern, err := m.NewResource(ctx, "api.v1.*", "", "pattern", "", false)
+	require.NoError(t, err)
+	users, err := m.NewResource(ctx, "api.v1.users", "", "endpoint", "", true)
+	require.NoError(t, err)
+	items, err := m.NewResource(ctx, "api.v1.{id}.items", "", "endpoint", "", true)
+	require.NoError(t, err)
+
+	require.NoError(t, m.AddPermissionResourceToRole(ctx, role, pattern, AccessRead, AccessWrite))
+	require.NoError(t, m.AddPermissionResourceToRole(ctx, role, users, AccessRead))
+	require.NoError(t, m.AddRoleToUser(ctx, role, "user-1", ""))
+
+	ok, err := m.UserHasPermissionForResource(ctx, "user-1", "", items, AccessWrite)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, _ = m.UserHasPermissionForResource(ctx, "user-1", "", users, AccessWrite)
+	assert.False(t, ok)
+
+	ok, err = m.RoleHasPermission(ctx, role, users, AccessRead)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
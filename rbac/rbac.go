@@ -2,6 +2,7 @@ package rbac
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"sort"
 	"strings"
@@ -14,6 +15,10 @@ const (
 	AccessDelete = 8
 )
 
+// ErrAccessDenied is returned by the *HasPermissionForResource methods when the roles of the
+// user match the resource but don't grant the requested access.
+var ErrAccessDenied = errors.New("user does not have access to resource")
+
 // A User can be a firebase uuid, a service account id, or an account id
 type AccountUserRole struct {
 	AccountID        string `json:"account_id" db:"account_id" qc:"primary;join;join_name::account_id"`
@@ -100,6 +105,13 @@ type RoleResourcePermissions struct {
 	CreatedTimestamp string `json:"created_timestamp" db:"created_timestamp" qc:"skip;default::created_timestamp"`
 }
 
+// ReplaceResult is the change applied by a Replace* call. Added and Removed hold the ids of the
+// groups or roles, for ReplacePermissionsInRole they hold the access values of the resource.
+type ReplaceResult struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
 type RBAC interface {
 	GetAccountsForUser(ctx context.Context, userID string) ([]*AccountUserRole, error)
 
@@ -129,19 +141,19 @@ type RBAC interface {
 
 	AddGroupToUser(ctx context.Context, group *RoleGroup, userID string, userType string) error
 	RemoveGroupFromUser(ctx context.Context, group *RoleGroup, userID string) error
-	ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) error
+	ReplaceGroupInUser(ctx context.Context, group *RoleGroup, userID string) (*ReplaceResult, error)
 
 	AddRoleToUser(ctx context.Context, role *Role, userID string, userType string) error
 	RemoveRoleFromUser(ctx context.Context, role *Role, userID string) error
-	ReplaceRoleInUser(ctx context.Context, role *Role, userID string) error
+	ReplaceRoleInUser(ctx context.Context, role *Role, userID string) (*ReplaceResult, error)
 
 	AddPermissionResourceToRole(ctx context.Context, role *Role, resource *Resource, access ...int) error
 	RemovePermissionsFromRole(ctx context.Context, role *Role, resources ...*Resource) error
-	ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) error
+	ReplacePermissionsInRole(ctx context.Context, role *Role, resource *Resource, access ...int) (*ReplaceResult, error)
 
 	AddRoleToGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error
 	RemoveRoleFromGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error
-	ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) error
+	ReplaceRoleInGroup(ctx context.Context, group *RoleGroup, roles ...*Role) (*ReplaceResult, error)
 
 	GetRole(ctx context.Context, roleID string) (*Role, error)
 	GetRoleWithName(ctx context.Context, name string) (*Role, error)
@@ -161,6 +173,7 @@ type RBAC interface {
 
 	RoleHasPermission(ctx context.Context, role *Role, resource *Resource, access ...int) (bool, error)
 	RoleHasAnyPermission(ctx context.Context, role *Role, resources []*Resource, access ...int) (bool, error)
+	// RoleHasAllPermissions reports whether the role has access to every resource, false without resources.
 	RoleHasAllPermissions(ctx context.Context, role *Role, resources []*Resource, access ...int) (bool, error)
 
 	GetUserGroupWithType(ctx context.Context, userID string, userType string) ([]*UserGroup, error)
@@ -169,6 +182,8 @@ type RBAC interface {
 	UserHasAnyPermissionForResource(ctx context.Context, userID, accountID string, resources []*Resource, access ...int) (bool, error)
 
 	UserHasRole(ctx context.Context, userID string, role *Role) (bool, error)
+	// UserHasAllRoles reports whether the user has every role, either through its own and group
+	// roles or inside a single account, false without roles.
 	UserHasAllRoles(ctx context.Context, userID string, roles ...*Role) (bool, error)
 	UserHasAnyRoles(ctx context.Context, userID, accountID string, role ...*Role) (bool, error)
 
@@ -0,0 +1,162 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Seann-Moser/cutil/cachec"
+	"github.com/Seann-Moser/cutil/sqlc"
+	"github.com/Seann-Moser/cutil/sqlc/orm"
+	"github.com/Seann-Moser/cutil/sqlc/orm/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+var ErrNoTxBeginner = errors.New("rbac: no transaction source set, see Impl.SetTxBeginner")
+
+// TxBeginner starts the transactions the Replace* methods run in, *sqlx.DB implements it.
+type TxBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+var _ db.DB = &txDB{}
+
+// txDB runs the queries of the orm tables inside a transaction.
+type txDB struct {
+	tx *sqlx.Tx
+}
+
+func (t *txDB) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (t *txDB) CreateTable(ctx context.Context, dataset, table string, columns map[string]db.Column) error {
+	return fmt.Errorf("creating table %s.%s is not supported in a transaction", dataset, table)
+}
+
+func (t *txDB) QueryContext(ctx context.Context, query string, args interface{}) (db.DBRow, error) {
+	return sqlx.NamedQueryContext(ctx, t.tx, query, args)
+}
+
+func (t *txDB) ExecContext(ctx context.Context, query string, args interface{}) error {
+	_, err := t.tx.NamedExecContext(ctx, query, args)
+	return err
+}
+
+func (t *txDB) Close() {}
+
+func (t *txDB) GetDataset(ds string) string {
+	return ds
+}
+
+// inTx runs f in a transaction that is committed when f succeeds and rolled back otherwise.
+func inTx(ctx context.Context, beginner TxBeginner, f func(tx db.DB) error) (err error) {
+	if beginner == nil {
+		return ErrNoTxBeginner
+	}
+	tx, err := beginner.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed starting transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = f(&txDB{tx: tx}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			err = multierr.Append(err, fmt.Errorf("failed rolling back transaction: %w", rollbackErr))
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// diffIDs returns the ids in desired missing from current and the ids in current missing from desired.
+func diffIDs(current []string, desired []string) *ReplaceResult {
+	result := &ReplaceResult{Added: []string{}, Removed: []string{}}
+	currentSet := map[string]bool{}
+	for _, id := range current {
+		currentSet[id] = true
+	}
+	desiredSet := map[string]bool{}
+	for _, id := range desired {
+		if desiredSet[id] {
+			continue
+		}
+		desiredSet[id] = true
+		if !currentSet[id] {
+			result.Added = append(result.Added, id)
+		}
+	}
+	for id := range currentSet {
+		if !desiredSet[id] {
+			result.Removed = append(result.Removed, id)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	return result
+}
+
+// currentUserType returns the first user type set on the current rows of a user.
+func currentUserType[T any](rows []*T, userType func(row *T) string) string {
+	for _, row := range rows {
+		if t := userType(row); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// replaceIDs makes the ids of the rows in the table of T that match where exactly desired.
+// The rows are read, deleted and inserted in a single transaction, newRow gets the rows read
+// so added rows can carry over their values.
+func replaceIDs[T any](ctx context.Context, beginner TxBeginner, where map[string]string, desired []string, id func(row *T) string, newRow func(id string, current []*T) (T, error)) (*ReplaceResult, error) {
+	table, err := sqlc.GetTableCtx[T](ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result *ReplaceResult
+	err = inTx(ctx, beginner, func(tx db.DB) error {
+		q := orm.QueryTable[T](table)
+		for column, value := range where {
+			q = q.Where(table.GetColumn(column), "=", "AND", 0, value)
+		}
+		rows, err := q.Run(ctx, tx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		current := map[string]*T{}
+		var currentIDs []string
+		for _, row := range rows {
+			current[id(row)] = row
+			currentIDs = append(currentIDs, id(row))
+		}
+		result = diffIDs(currentIDs, desired)
+		for _, removed := range result.Removed {
+			if err = table.Delete(ctx, tx, *current[removed]); err != nil {
+				return fmt.Errorf("failed removing %s: %w", removed, err)
+			}
+		}
+		for _, added := range result.Added {
+			row, err := newRow(added, rows)
+			if err != nil {
+				return err
+			}
+			if _, err = table.Insert(ctx, tx, row); err != nil {
+				return fmt.Errorf("failed adding %s: %w", added, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	_ = cachec.GlobalCacheMonitor.DeleteCache(ctx, table.FullTableName())
+	return result, nil
+}
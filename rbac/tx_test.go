@@ -0,0 +1,261 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Seann-Moser/cutil/sqlc/orm"
+	"github.com/Seann-Moser/cutil/sqlc/orm/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingConn is a database/sql connection that only counts transaction outcomes.
+type countingConn struct {
+	commits   int
+	rollbacks int
+}
+
+func (c *countingConn) Connect(ctx context.Context) (driver.Conn, error) { return c, nil }
+func (c *countingConn) Driver() driver.Driver                            { return nil }
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *countingConn) Commit() error {
+	c.commits++
+	return nil
+}
+func (c *countingConn) Rollback() error {
+	c.rollbacks++
+	return nil
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+	conn := &countingConn{}
+	database := sqlx.NewDb(sql.OpenDB(conn), "mysql")
+
+	require.NoError(t, inTx(ctx, database, func(tx db.DB) error {
+		_, ok := tx.(*txDB)
+		assert.True(t, ok)
+		return nil
+	}))
+	assert.Equal(t, 1, conn.commits)
+	assert.Equal(t, 0, conn.rollbacks)
+
+	failed := errors.New("insert failed")
+	err := inTx(ctx, database, func(tx db.DB) error {
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 1, conn.commits)
+	assert.Equal(t, 1, conn.rollbacks)
+
+	assert.ErrorIs(t, inTx(ctx, nil, func(tx db.DB) error { return nil }), ErrNoTxBeginner)
+	_, err = New().ReplaceRoleInUser(ctx, &Role{ID: "role"}, "user")
+	assert.Error(t, err)
+}
+
+func TestDiffIDs(t *testing.T) {
+	result := diffIDs([]string{"a", "b", "c"}, []string{"c", "d", "d", "a"})
+	assert.Equal(t, []string{"d"}, result.Added)
+	assert.Equal(t, []string{"b"}, result.Removed)
+
+	result = diffIDs(nil, nil)
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Removed)
+}
+
+// fakeDB is a db.DB on a fakeConn, transactions started by beginner run on the same conn through txDB.
+type fakeDB struct {
+	conn *fakeConn
+	db   *sqlx.DB
+}
+
+func newFakeDB(conn *fakeConn) *fakeDB {
+	return &fakeDB{conn: conn, db: sqlx.NewDb(sql.OpenDB(conn), "mysql")}
+}
+
+func (f *fakeDB) Ping(ctx context.Context) error { return nil }
+func (f *fakeDB) CreateTable(ctx context.Context, dataset, table string, columns map[string]db.Column) error {
+	return nil
+}
+func (f *fakeDB) QueryContext(ctx context.Context, query string, args interface{}) (db.DBRow, error) {
+	return sqlx.NamedQueryContext(ctx, f.db, query, args)
+}
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args interface{}) error {
+	_, err := f.db.NamedExecContext(ctx, query, args)
+	return err
+}
+func (f *fakeDB) Close()                      {}
+func (f *fakeDB) GetDataset(ds string) string { return ds }
+func (f *fakeDB) beginner() TxBeginner        { return f.db }
+func (f *fakeDB) statements(verb string) [][]driver.Value {
+	var args [][]driver.Value
+	for _, e := range f.conn.execs {
+		if strings.HasPrefix(e.query, verb) {
+			args = append(args, e.args)
+		}
+	}
+	return args
+}
+
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeTable holds the rows of a table, rows are filtered by the "table.column = ?" conditions
+// of a select on the columns of the table, conditions on joined tables are ignored.
+type fakeTable struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// fakeTableOf converts rows into a fakeTable using their db tags.
+func fakeTableOf[T any](rows ...*T) *fakeTable {
+	table := &fakeTable{}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		table.columns = append(table.columns, t.Field(i).Tag.Get("db"))
+	}
+	for _, row := range rows {
+		v := reflect.ValueOf(row).Elem()
+		var values []driver.Value
+		for i := 0; i < v.NumField(); i++ {
+			values = append(values, v.Field(i).Interface())
+		}
+		table.rows = append(table.rows, values)
+	}
+	return table
+}
+
+// fakeConn is a database/sql connection selecting from tables by their full name and
+// recording the other statements, statements starting with failOn fail.
+type fakeConn struct {
+	countingConn
+	tables map[string]*fakeTable
+	failOn string
+	execs  []fakeExec
+}
+
+func (c *fakeConn) Connect(ctx context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                        { return c, nil }
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: strings.TrimSpace(query)}, nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.conn.failOn != "" && strings.HasPrefix(s.query, s.conn.failOn) {
+		return nil, errors.New("statement failed")
+	}
+	s.conn.execs = append(s.conn.execs, fakeExec{query: s.query, args: args})
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fields := strings.Fields(s.query)
+	var name string
+	for i, field := range fields {
+		if field == "FROM" && i+1 < len(fields) {
+			name = fields[i+1]
+			break
+		}
+	}
+	table, found := s.conn.tables[name]
+	if !found {
+		return nil, fmt.Errorf("unknown table %q", name)
+	}
+	_, short, _ := strings.Cut(name, ".")
+	filter := map[int]driver.Value{}
+	if _, where, found := strings.Cut(s.query, "WHERE"); found {
+		for i, condition := range strings.Split(where, "AND") {
+			column, _, _ := strings.Cut(strings.TrimSpace(condition), " ")
+			tableName, column, _ := strings.Cut(column, ".")
+			for j, c := range table.columns {
+				if tableName == short && c == column && i < len(args) {
+					filter[j] = args[i]
+				}
+			}
+		}
+	}
+	rows := &fakeRows{columns: table.columns}
+	for _, row := range table.rows {
+		matches := true
+		for j, value := range filter {
+			matches = matches && fmt.Sprint(row[j]) == fmt.Sprint(value)
+		}
+		if matches {
+			rows.rows = append(rows.rows, row)
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestReplaceIDs(t *testing.T) {
+	fake := newFakeDB(&fakeConn{tables: map[string]*fakeTable{
+		"rbac.user_group": fakeTableOf(
+			&UserGroup{GroupID: "staff", UserID: "user-1"},
+			&UserGroup{GroupID: "ops", UserID: "user-1", UserType: "member"},
+			&UserGroup{GroupID: "admins", UserID: "user-1", UserType: "member"},
+			&UserGroup{GroupID: "ops", UserID: "user-2", UserType: "guest"},
+		),
+	}})
+	ctx, err := orm.AddTableCtx[UserGroup](context.Background(), fake, queryDatabase, queryType)
+	require.NoError(t, err)
+	r := New().SetTxBeginner(fake.beginner())
+
+	result, err := r.ReplaceGroupInUser(ctx, &RoleGroup{ID: "billing"}, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaceResult{Added: []string{"billing"}, Removed: []string{"admins", "ops", "staff"}}, result)
+	assert.Equal(t, 1, fake.conn.commits)
+	assert.Len(t, fake.statements("DELETE"), 3)
+	inserts := fake.statements("INSERT")
+	require.Len(t, inserts, 1)
+	assert.ElementsMatch(t, []driver.Value{"billing", "user-1", "member"}, inserts[0], "the user type of the current rows is carried over")
+
+	fake.conn.execs = nil
+	result, err = r.ReplaceGroupInUser(ctx, &RoleGroup{ID: "admins"}, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, &ReplaceResult{Added: []string{}, Removed: []string{"ops", "staff"}}, result)
+	assert.Empty(t, fake.statements("INSERT"), "kept rows are not inserted again")
+
+	fake.conn.execs = nil
+	fake.conn.failOn = "INSERT"
+	_, err = r.ReplaceGroupInUser(ctx, &RoleGroup{ID: "billing"}, "user-1")
+	assert.Error(t, err)
+	assert.Equal(t, 2, fake.conn.commits)
+	assert.Equal(t, 1, fake.conn.rollbacks, "a failed insert rolls back the deletes")
+}
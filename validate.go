@@ -0,0 +1,350 @@
+package rutil
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FieldError describes a single failed validation rule.
+type FieldError struct {
+	Path    string `json:"path"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", fe.Path, fe.Message)
+}
+
+// ValidationErrors is returned by Validate when one or more fields fail their rules.
+type ValidationErrors []*FieldError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, 0, len(ve))
+	for _, fe := range ve {
+		messages = append(messages, fe.Error())
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+var regexCache sync.Map
+
+// rfRequired is the rule of fields tagged `rf:"required"`, it keeps the isEmpty semantics of
+// CheckRequiredFields so 0 and false are accepted.
+const rfRequired = "required=rf"
+
+// Validate checks the `validate` struct tags of i, walking nested structs, pointers, slices and maps.
+// Rules are separated by commas, a literal comma in a rule value is written as `\,`:
+//
+//	required      the value is not the zero value, pointers must not be nil
+//	omitempty     skip the remaining rules when the value is the zero value
+//	min=N, max=N  bounds for numbers, length bounds for strings, slices and maps
+//	len=N         exact length of strings, slices and maps
+//	regex=expr    strings have to match the regular expression
+//	oneof=a b c   the value has to be one of the space separated values
+//	email, uuid, url
+//	dive          the rules after dive are applied to every element of a slice or map
+//
+// Fields tagged `rf:"required"` are treated as `validate:"required"` except that only nil and empty
+// strings, slices and maps are missing, 0 and false are accepted.
+// Failed rules are returned as ValidationErrors with the json path of the field,
+// an invalid tag returns a plain error.
+func Validate(i interface{}) error {
+	var errs ValidationErrors
+	if err := validateValue(reflect.ValueOf(i), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, errs *ValidationErrors) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for j := 0; j < t.NumField(); j++ {
+			field := t.Field(j)
+			if !field.IsExported() {
+				continue
+			}
+			name, skip := jsonName(field)
+			if skip {
+				continue
+			}
+			fieldPath := path
+			if !(field.Anonymous && name == "") {
+				if name == "" {
+					name = field.Name
+				}
+				fieldPath = joinPath(path, name)
+			}
+			rules := splitRules(field.Tag.Get("validate"))
+			if field.Tag.Get("rf") == "required" && !containsRule(rules, "required") {
+				rules = append([]string{rfRequired}, rules...)
+			}
+			if err := applyRules(v.Field(j), fieldPath, rules, errs); err != nil {
+				return fmt.Errorf("field %s.%s: %w", t.Name(), field.Name, err)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for j := 0; j < v.Len(); j++ {
+			if err := validateValue(v.Index(j), fmt.Sprintf("%s[%d]", path, j), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if err := validateValue(v.MapIndex(key), joinPath(path, fmt.Sprint(key.Interface())), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyRules runs rules against v and then walks into v to validate nested values.
+func applyRules(v reflect.Value, path string, rules []string, errs *ValidationErrors) error {
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if v.IsZero() {
+				return nil
+			}
+			continue
+		case "dive":
+			elem := indirect(v)
+			if !elem.IsValid() {
+				return nil
+			}
+			switch elem.Kind() {
+			case reflect.Slice, reflect.Array:
+				for j := 0; j < elem.Len(); j++ {
+					if err := applyRules(elem.Index(j), fmt.Sprintf("%s[%d]", path, j), rules[i+1:], errs); err != nil {
+						return err
+					}
+				}
+			case reflect.Map:
+				for _, key := range elem.MapKeys() {
+					if err := applyRules(elem.MapIndex(key), joinPath(path, fmt.Sprint(key.Interface())), rules[i+1:], errs); err != nil {
+						return err
+					}
+				}
+			default:
+				return fmt.Errorf("dive requires a slice or map, got %s", elem.Kind())
+			}
+			return nil
+		}
+
+		if name != "required" && indirect(v).Kind() == reflect.Invalid {
+			// optional pointers are only checked when set
+			continue
+		}
+		message, err := checkRule(v, name, param)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			*errs = append(*errs, &FieldError{Path: path, Rule: name, Message: message})
+			if name == "required" {
+				return nil
+			}
+		}
+	}
+	return validateValue(v, path, errs)
+}
+
+// checkRule returns a message when v fails the rule.
+func checkRule(v reflect.Value, name, param string) (string, error) {
+	if name == "required" {
+		if param == "rf" {
+			if isEmpty(v.Interface()) {
+				return "is required", nil
+			}
+			return "", nil
+		}
+		if v.IsZero() || (v.Kind() != reflect.Ptr && isEmpty(v.Interface())) {
+			return "is required", nil
+		}
+		return "", nil
+	}
+	v = indirect(v)
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s value %q", name, param)
+		}
+		size, isLength, ok := measure(v)
+		if !ok {
+			return "", fmt.Errorf("%s is not supported for %s", name, v.Kind())
+		}
+		unit := ""
+		if isLength {
+			unit = " in length"
+		}
+		switch {
+		case name == "min" && size < limit:
+			return fmt.Sprintf("must be at least %s%s", param, unit), nil
+		case name == "max" && size > limit:
+			return fmt.Sprintf("must be at most %s%s", param, unit), nil
+		case name == "len" && (!isLength || size != limit):
+			return fmt.Sprintf("must be exactly %s in length", param), nil
+		}
+	case "regex":
+		re, err := compileRegex(param)
+		if err != nil {
+			return "", err
+		}
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("regex is not supported for %s", v.Kind())
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Sprintf("must match %s", param), nil
+		}
+	case "oneof":
+		options := strings.Fields(param)
+		value := fmt.Sprint(v.Interface())
+		for _, o := range options {
+			if o == value {
+				return "", nil
+			}
+		}
+		return "must be one of " + strings.Join(options, ", "), nil
+	case "email":
+		if addr, err := mail.ParseAddress(stringValue(v)); err != nil || addr.Address != stringValue(v) {
+			return "must be a valid email address", nil
+		}
+	case "uuid":
+		if _, err := uuid.Parse(stringValue(v)); err != nil {
+			return "must be a valid uuid", nil
+		}
+	case "url":
+		if u, err := url.ParseRequestURI(stringValue(v)); err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be a valid url", nil
+		}
+	default:
+		return "", fmt.Errorf("unknown validation rule %q", name)
+	}
+	return "", nil
+}
+
+func measure(v reflect.Value) (float64, bool, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if re, found := regexCache.Load(expr); found {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+	regexCache.Store(expr, re)
+	return re, nil
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func stringValue(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func splitRules(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	var (
+		rules   []string
+		current strings.Builder
+	)
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			rules = append(rules, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(tag[i])
+		}
+	}
+	return append(rules, strings.TrimSpace(current.String()))
+}
+
+func containsRule(rules []string, name string) bool {
+	for _, r := range rules {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	return strings.Split(tag, ",")[0], false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// IsValidationError reports whether err contains ValidationErrors and returns them.
+func IsValidationError(err error) (ValidationErrors, bool) {
+	var ve ValidationErrors
+	if errors.As(err, &ve) {
+		return ve, true
+	}
+	return nil, false
+}
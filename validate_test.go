@@ -0,0 +1,113 @@
+package rutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"omitempty,regex=^[0-9]{5}$"`
+}
+
+type validateUser struct {
+	ID        string             `json:"id" validate:"uuid"`
+	Name      string             `json:"name" rf:"required" validate:"min=2,max=10"`
+	Email     string             `json:"email" validate:"required,email"`
+	Age       int                `json:"age" validate:"min=18,max=130"`
+	Role      string             `json:"role" validate:"oneof=admin user"`
+	Website   *string            `json:"website" validate:"url"`
+	Code      string             `json:"code" validate:"omitempty,len=3"`
+	Tags      []string           `json:"tags" validate:"max=2,dive,min=3"`
+	Addresses []*validateAddress `json:"addresses"`
+	Primary   validateAddress    `json:"primary"`
+}
+
+func validUser() validateUser {
+	return validateUser{
+		ID:      "0b7c5e5e-8a57-4a4a-a36f-8b7a1d5b9c11",
+		Name:    "John",
+		Email:   "john@example.com",
+		Age:     30,
+		Role:    "admin",
+		Primary: validateAddress{City: "Denver"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	site := "not a url"
+	tests := []struct {
+		name   string
+		modify func(u *validateUser)
+		want   []FieldError
+	}{
+		{"valid", func(u *validateUser) {}, nil},
+		{"missing name", func(u *validateUser) { u.Name = "" }, []FieldError{{Path: "name", Rule: "required"}}},
+		{"short name", func(u *validateUser) { u.Name = "J" }, []FieldError{{Path: "name", Rule: "min"}}},
+		{"bad email", func(u *validateUser) { u.Email = "john" }, []FieldError{{Path: "email", Rule: "email"}}},
+		{"bad uuid", func(u *validateUser) { u.ID = "123" }, []FieldError{{Path: "id", Rule: "uuid"}}},
+		{"too young", func(u *validateUser) { u.Age = 5 }, []FieldError{{Path: "age", Rule: "min"}}},
+		{"unknown role", func(u *validateUser) { u.Role = "root" }, []FieldError{{Path: "role", Rule: "oneof"}}},
+		{"bad url", func(u *validateUser) { u.Website = &site }, []FieldError{{Path: "website", Rule: "url"}}},
+		{"code length", func(u *validateUser) { u.Code = "ab" }, []FieldError{{Path: "code", Rule: "len"}}},
+		{"too many tags", func(u *validateUser) { u.Tags = []string{"abc", "def", "ghi"} }, []FieldError{{Path: "tags", Rule: "max"}}},
+		{"short tag", func(u *validateUser) { u.Tags = []string{"abc", "d"} }, []FieldError{{Path: "tags[1]", Rule: "min"}}},
+		{"nested slice", func(u *validateUser) {
+			u.Addresses = []*validateAddress{{City: "Austin"}, {Zip: "12"}}
+		}, []FieldError{{Path: "addresses[1].city", Rule: "required"}, {Path: "addresses[1].zip", Rule: "regex"}}},
+		{"nested struct", func(u *validateUser) { u.Primary.City = "" }, []FieldError{{Path: "primary.city", Rule: "required"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := validUser()
+			tt.modify(&u)
+			err := Validate(&u)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			fieldErrors, ok := IsValidationError(err)
+			require.True(t, ok, "expected validation errors, got %v", err)
+			require.Len(t, fieldErrors, len(tt.want))
+			for i, fe := range fieldErrors {
+				assert.Equal(t, tt.want[i].Path, fe.Path)
+				assert.Equal(t, tt.want[i].Rule, fe.Rule)
+				assert.NotEmpty(t, fe.Message)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidTag(t *testing.T) {
+	err := Validate(struct {
+		Name string `validate:"min=abc"`
+	}{Name: "a"})
+	require.Error(t, err)
+	_, ok := IsValidationError(err)
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"regex=^a,b$", "min=1"}, splitRules(`regex=^a\,b$,min=1`))
+	assert.NoError(t, Validate("not a struct"))
+}
+
+func TestValidateRFRequired(t *testing.T) {
+	type page struct {
+		Offset  int      `json:"offset" rf:"required"`
+		Enabled bool     `json:"enabled" rf:"required"`
+		Tags    []string `json:"tags" rf:"required"`
+		Parent  *page    `json:"parent" rf:"required"`
+		Count   int      `json:"count" validate:"required"`
+	}
+	leaf := &page{}
+	err := Validate(page{Tags: []string{"a"}, Parent: leaf, Count: 1})
+	fieldErrors, ok := IsValidationError(err)
+	require.True(t, ok, "expected validation errors, got %v", err)
+	var paths []string
+	for _, fe := range fieldErrors {
+		assert.Equal(t, "required", fe.Rule)
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{"parent.tags", "parent.parent", "parent.count"}, paths, "rf:\"required\" accepts 0 and false, validate:\"required\" does not")
+}